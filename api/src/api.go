@@ -1,325 +1,394 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"encoding/json"
+	"strconv"
+	"path"
+	"github.com/garyburd/redigo/redis"
 )
 
-const (
-	rateLimit = 50
-)
-
+//	ComputationResponse describes the stored experiment, Warnings are the diagnostics
+//	of the uploaded content which did not prevent the computation
 type ComputationResponse struct {
 	ExpiresAt, ExperimentId string
+	Warnings Diagnostics
 }
 
-type ConsumerRateLimit struct {
-	Exceeded bool
-	Limit, Current int
-	RetryAfter time.Time
+//	ExperimentDeletion answers deletes of experiments which other consumer tokens
+//	uploaded too, Deleted is false because the experiment stays readable until the
+//	last of them deletes it or it expires
+type ExperimentDeletion struct {
+	ExperimentId string
+	Deleted      bool
+	ExpiresAt    time.Time
 }
 
 func qpcrHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[handler|qpcr] request '%s'\n", r.URL)
-	log.Printf("[handler|qpcr] headers: %+v\n", r.Header)
+	consumerRateLimit := requestRateLimit(r)
 
-	if r.Method == "OPTIONS" {
-		log.Println("[handler|qpcr] options")
-		w.WriteHeader(http.StatusOK)
+	urlPath := strings.Split(r.URL.Path[1:], "/")
+	if len(urlPath) != 3 {
+		slog.WarnContext(r.Context(), "path is not valid", "component", "qpcr", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_path", "path is not valid")
 		return
 	}
 
-	var consumerRateLimit ConsumerRateLimit
-	var err error
-
-	if consumerRateLimit, err = checkIPAddressRateLimit(r); err != nil {
-		log.Printf("[handler|qpcr] checking consumer rate limit failed with error: %s\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	bodyContent, filename, ok := readUpload(w, r, uploadSizeLimit(consumerRateLimit))
+	if !ok {
 		return
 	}
+	if uploadFilename := getUploadFilename(r); len(uploadFilename) > 0 {
+		filename = uploadFilename
+	}
 
-	if consumerRateLimit.Exceeded {
-		w.Header().Add("Retry-After", fmt.Sprintf("%s", consumerRateLimit.RetryAfter))
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.WriteHeader(429)
+	instrument, found := findInstrument(urlPath[2])
+	if !found {
+		slog.WarnContext(r.Context(), "experiment computer type is not valid", "component", "qpcr", "instrument", urlPath[2])
+		writeProblem(w, r, http.StatusBadRequest, "unknown_instrument", fmt.Sprintf("instrument '%s' is not supported", urlPath[2]))
 		return
 	}
 
-	if r.Method != "POST" {
-		log.Printf("[handler|qpcr] method '%s' is not POST!\n", r.Method)
-		http.Error(w, "", http.StatusMethodNotAllowed)
+	mock := r.URL.Query().Get("mock")
+	if len(mock) == 0 {
+		slog.WarnContext(r.Context(), "missing mock query parameter", "component", "qpcr", "instrument", instrument.Name)
+		writeProblem(w, r, http.StatusBadRequest, "missing_mock", "mock query parameter is required")
 		return
 	}
+	slog.DebugContext(r.Context(), "experiment computer set", "component", "qpcr", "instrument", instrument.Name)
+	uploadsTotal.Inc(instrument.Name)
 
-	urlPath := strings.Split(r.URL.Path[1:], "/")
-	if len(urlPath) != 3 {
-		log.Printf("[handler|qpcr] path '%s' is not valid!\n", r.URL.Path[1:])
-		http.Error(w, "", http.StatusBadRequest)
+	uploadExperiment(w, r, consumerRateLimit, instrument.NewComputer(mock), instrument.Name, bodyContent, filename)
+}
+
+//	uploadSizeLimit is the max upload size of the consumer tier capped by the server limit
+func uploadSizeLimit(consumerRateLimit ConsumerRateLimit) int64 {
+	maxUploadSize := consumerRateLimit.Limits.MaxUploadSize
+	if maxUploadSize <= 0 {
+		maxUploadSize = unlimitedUploadSize
+	}
+	if serverMaxUploadSize > 0 && serverMaxUploadSize < maxUploadSize {
+		maxUploadSize = serverMaxUploadSize
+	}
+
+	return maxUploadSize
+}
+
+//	uploadExperiment computes the upload right away or as a job when the client prefers
+//	an asynchronous response, Location points to the resource of the request api version
+func uploadExperiment(w http.ResponseWriter, r *http.Request, consumerRateLimit ConsumerRateLimit, expComputer ExperimentComputer, instrument string, bodyContent []byte, filename string) {
+	callback, ok := requestCallback(w, r, consumerRateLimit.token)
+	if !ok {
 		return
 	}
 
-	bodyContent, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		log.Println("[handler|qpcr] body parameter is not valid!")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	reservedAt, ok := checkUploadQuota(w, r, consumerRateLimit)
+	if !ok {
 		return
 	}
 
-	var expComputer ExperimentComputer
-	switch urlPath[2] {
-	case "ab7300":
-		mock := r.FormValue("mock")
-		if len(mock) == 0 {
-			log.Println("[handler|qpcr|ab7300] missing mock query parameter!")
-			http.Error(w, "", http.StatusBadRequest)
-			return
-		}
-		log.Println("[handler|qpcr] experiment computer set to ab7300")
-		expComputer = &AB7300{Content: string(bodyContent), Mock: mock}
-	default:
-		log.Printf("[handler|qpcr] experiment computer type '%s' is not valid!", urlPath[1])
-		http.Error(w, "", http.StatusBadRequest)
+	if preferAsync(r) {
+		submitExperimentJob(w, r, consumerRateLimit, reservedAt, expComputer, callback, instrument, bodyContent, filename)
 		return
 	}
 
-	expId := doExperimentComputation(w, expComputer)
-	if len(expId) == 0 {
+	expId, created, expiresAt, warnings, err := computeExperiment(r.Context(), expComputer, instrument, bodyContent, filename, consumerRateLimit.owner())
+	notifyCallback(r.Context(), callback, "", expId, warnings, err)
+	if err != nil {
+		releaseUpload(r.Context(), consumerRateLimit, reservedAt)
+		writeProblemDocument(w, r, computationProblem(err))
 		return
 	}
 
-	w.Header().Add("Location", "http://api.fastqpcr.com/experiment/" + expId)
-	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Add("Location", experimentPath(r, expId))
 	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		slog.InfoContext(r.Context(), "experiment already exists", "component", "qpcr", "experiment_id", expId)
+		w.WriteHeader(http.StatusOK)
+	}
 
 	computationResponse := ComputationResponse{}
-	computationResponse.ExpiresAt = fmt.Sprintf("%s", time.Now().Add(time.Duration(30) * time.Minute))
+	computationResponse.ExpiresAt = fmt.Sprintf("%s", expiresAt)
 	computationResponse.ExperimentId = expId
+	computationResponse.Warnings = warnings
 
 	response, err := json.Marshal(computationResponse)
 	if err != nil {
-		log.Printf("[handler|qpcr] marshalling computationResponse failed with error '%s'\n", err)
+		slog.ErrorContext(r.Context(), "marshalling computation response failed", "component", "qpcr", "error", err)
 	}
 	w.Write(response)
 }
 
-func doExperimentComputation(w http.ResponseWriter, expComputer ExperimentComputer) string {
-	e, err := expComputer.Compute()
+//	computeExperiment computes and stores the experiment, problems of the uploaded
+//	content are returned as *ComputeError
+func computeExperiment(ctx context.Context, expComputer ExperimentComputer, instrument string, source []byte, filename, owner string) (string, bool, time.Time, Diagnostics, error) {
+	timeStart := time.Now()
+	e, err := expComputer.Compute(bytes.NewReader(source))
+	experimentComputeDuration.Observe(time.Since(timeStart).Seconds(), instrument)
 	if err != nil {
-		log.Printf("[handler|qpcr] experiment computation failed with error '%s'!\n", err)
-		http.Error(w, "", http.StatusBadRequest)
-		return ""
+		parseFailuresTotal.Inc(instrument)
+		slog.WarnContext(ctx, "experiment computation failed", "component", "qpcr", "instrument", instrument, "error", err)
+		if _, ok := err.(*ComputeError); !ok {
+			err = &ComputeError{Code: "computation_failed", Message: err.Error()}
+		}
+		return "", false, time.Time{}, nil, err
 	}
 
-	expId, err := SaveExperiment(e)
+	expId, created, expiresAt, err := SaveExperiment(e, source, newExperimentMeta(e, filename), owner)
 	if err != nil {
-		log.Printf("[handler|qpcr] experiment computation persistence failed with error '%s'!\n", err)
-		http.Error(w, "", http.StatusInternalServerError)
-		return ""
+		slog.ErrorContext(ctx, "saving experiment failed", "component", "qpcr", "error", err)
+		return "", false, expiresAt, nil, err
 	}
 
-	log.Printf("[handler|qpcr] experiment computed, key %s \n", expId)
+	warnings := e.Diagnostics()
+	if warnings == nil {
+		warnings = Diagnostics{}
+	}
+	slog.InfoContext(ctx, "experiment computed", "component", "qpcr", "experiment_id", expId, "instrument", instrument, "warnings", len(warnings))
 
-	return expId
+	return expId, created, expiresAt, warnings, nil
 }
 
-func experimentHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[handler|experiment] request  %s\n", r.URL)
-	log.Printf("[handler|experiment] headers: %+v\n", r.Header)
+//	computationProblem describes a computeExperiment error, errors other than
+//	*ComputeError are failures of the storage
+func computationProblem(err error) Problem {
+	if ce, ok := err.(*ComputeError); ok {
+		return newProblem(http.StatusBadRequest, ce.Code, ce.Message, ce.Diagnostics)
+	}
 
-	if r.Method == "OPTIONS" {
-		log.Println("[handler|experiment] options")
-		w.WriteHeader(http.StatusOK)
+	return newProblem(http.StatusInternalServerError, "internal_error", "saving experiment failed", nil)
+}
+
+func experimentHandler(w http.ResponseWriter, r *http.Request) {
+	urlPath := strings.Split(r.URL.Path[1:], "/")
+	if len(urlPath) != 3 {
+		slog.WarnContext(r.Context(), "path is not valid", "component", "experiment", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_path", "path is not valid")
 		return
 	}
 
-	var consumerRateLimit ConsumerRateLimit
-	var err error
+	//	/v1/experiment/{id}.{format} selects the format like ?format=
+	expId, extension, _ := strings.Cut(urlPath[2], ".")
 
-	if consumerRateLimit, err = checkIPAddressRateLimit(r); err != nil {
-		log.Printf("[handler|qpcr] checking consumer rate limit failed with error: %s\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if r.Method == "DELETE" {
+		deleteExperiment(w, r, expId)
 		return
 	}
 
-	if consumerRateLimit.Exceeded {
-		w.Header().Add("Retry-After", fmt.Sprintf("%s", consumerRateLimit.RetryAfter))
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.WriteHeader(429)
+	serveExperimentResults(w, r, expId, extension)
+}
+
+//	serveExperimentResults exports the experiment in the format of the format query
+//	parameter, the path extension or the Accept header, see requestExportFormat
+func serveExperimentResults(w http.ResponseWriter, r *http.Request, expId, extension string) {
+	format, ok := requestExportFormat(w, r, extension, exportContentTypes(false))
+	if !ok {
 		return
 	}
-
-	if r.Method != "GET" {
-		log.Printf("[handler|experiment] method '%s' is not GET!\n", r.Method)
-		http.Error(w, "", http.StatusMethodNotAllowed)
+	options, ok := requestExportOptions(w, r, format.Defaults)
+	if !ok {
 		return
 	}
+	slog.DebugContext(r.Context(), "export format set", "component", "experiment", "content_type", format.ContentType)
 
-	var ex Exporter
-	accept := r.Header.Get("Accept")
-	if accept == "" {
-		log.Println("[handler|experiment] accept type is not set, using application/json")
-		accept = "application/json"
-	}
-
-	switch strings.ToLower(accept) {
-	case "application/json":
-		log.Println("[handler|experiment] exporter set to json")
-		ex = &JSONExport{}
-	case "application/xml":
-		log.Println("[handler|experiment] exporter set to xml")
-		ex = &XMLExport{}
-	case "text/csv":
-		log.Println("[handler|experiment] exporter set to csv")
-		ex = &CSVExport{}
-	case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
-		log.Println("[handler|experiment] exporter set to xlsx")
-		ex = &XLSXExport{}
-	case "application/vnd.oasis.opendocument.spreadsheet":
-		log.Println("[handler|experiment] experiment computer set to ods")
-		ex = &ODSExport{}
-	default:
-		log.Printf("[handler|experiment] accept type '%s' is not valid!\n", accept)
-		http.Error(w, "", http.StatusBadRequest)
+	ttl, err := GetExperimentTTL(expId)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "experiment not found", "component", "experiment", "experiment_id", expId)
+		writeProblem(w, r, http.StatusNotFound, "experiment_not_found", "experiment not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment ttl failed", "component", "experiment", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment ttl failed")
 		return
 	}
 
-	urlPath := strings.Split(r.URL.Path[1:], "/")
-	if len(urlPath) != 3 {
-		log.Printf("[handler|experiment] experiment id '%s' is not valid!\n", r.URL.Path[1:])
-		http.Error(w, "", http.StatusBadRequest)
+	etag := experimentETag(expId, format, options)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+	w.Header().Add("Vary", "Accept")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		slog.DebugContext(r.Context(), "experiment not modified", "component", "experiment", "experiment_id", expId)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	content := readExperimentResults(w, urlPath[2], ex)
+	content := readExperimentResults(w, r, expId, format, options)
 	if len(content) == 0 {
 		return
 	}
 
-	w.Header().Add("Content-Type", ex.ContentType())
+	w.Header().Add("Content-Type", format.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	if format.Attachment {
+		w.Header().Set("Content-Disposition", attachmentDisposition(experimentDownloadName(expId, requestRateLimit(r).owner()), format))
+	}
+	if r.Method == "HEAD" {
+		return
+	}
 	w.Write(content)
 }
 
-func readExperimentResults(w http.ResponseWriter, expId string, ex Exporter) []byte {
-	expBytes, err := GetExperiment(expId)
-	if err != nil {
-		log.Printf("[handler|experiment] experiment id '%s' not found!\n", expId)
-		http.Error(w, "", http.StatusNotFound)
-		return []byte{}
+//	experimentDownloadName names downloads after the run file the owner uploaded,
+//	experiments without a filename of the owner are named after their id
+func experimentDownloadName(expId, owner string) string {
+	if meta, err := GetExperimentMeta(expId, owner); err == nil && len(meta.Filename) > 0 {
+		return strings.TrimSuffix(meta.Filename, path.Ext(meta.Filename)) + "-results"
 	}
-
-	var e Experiment
-	err = json.Unmarshal(expBytes, &e)
-	if err != nil {
-		log.Printf("[handler|experiment] parsing experiment id '%s' failed!\n", expId)
-		http.Error(w, "", http.StatusInternalServerError)
-		return []byte{}
+	if len(expId) > 12 {
+		expId = expId[:12]
 	}
 
-	content, err := ex.Export(&e)
-	if err != nil {
-		log.Printf("[handler|experiment] exporting experiment id '%s' failed!\n", expId)
-		http.Error(w, "", http.StatusInternalServerError)
-		return []byte{}
-	}
+	return "experiment-" + expId
+}
 
-	log.Println("[handler|experiment] experiment content generated")
+//	experimentETag returns a strong entity tag for the experiment in the given export
+//	format, exporter version and options. Experiment ids are content hashes, so the tag
+//	changes only when the exporter version is bumped.
+func experimentETag(expId string, format ExportFormat, options ExportOptions) string {
+	return fmt.Sprintf("\"%s-%s\"", expId, getExpId(fmt.Sprintf("%s %d %+v", format.ContentType, format.Version, options))[:12])
+}
 
-	return content
+//	etagMatches reports whether the If-None-Match header value matches the entity tag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
 }
 
-func rateLimitHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("[handler|ratelimit] request  %s\n", r.URL)
-	log.Printf("[handler|ratelimit] headers: %+v\n", r.Header)
+//	deleteExperiment removes the experiment of the consumer token and responds with
+//	204. Experiments uploaded by other tokens too stay stored until their last owner
+//	deletes them, only the reference of the token is removed and the response is 200
+//	with an ExperimentDeletion.
+func deleteExperiment(w http.ResponseWriter, r *http.Request, expId string) {
+	ct, ok := authenticateConsumer(w, r)
+	if !ok {
+		return
+	}
 
-	if r.Method == "OPTIONS" {
-		log.Println("[handler|ratelimit] options")
-		w.WriteHeader(http.StatusOK)
+	owned, err := IsExperimentOwner(expId, ct.TokenId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment owner failed", "component", "experiment", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment owner failed")
 		return
 	}
 
-	var consumerRateLimit ConsumerRateLimit
-	var err error
+	if !owned {
+		if _, err = GetExperimentTTL(expId); err == redis.ErrNil {
+			slog.InfoContext(r.Context(), "experiment not found", "component", "experiment", "experiment_id", expId)
+			writeProblem(w, r, http.StatusNotFound, "experiment_not_found", "experiment not found")
+			return
+		}
 
-	if consumerRateLimit, err = checkIPAddressRateLimit(r); err != nil {
-		log.Printf("[handler|ratelimit] checking consumer rate limit failed with error: %s\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		slog.WarnContext(r.Context(), "experiment is not owned by the consumer token", "component", "experiment", "experiment_id", expId, "token_id", ct.TokenId)
+		writeProblem(w, r, http.StatusForbidden, "not_owner", "experiment is not owned by the consumer token")
 		return
 	}
 
-	if consumerRateLimit.Exceeded {
-		w.Header().Add("Retry-After", fmt.Sprintf("%s", consumerRateLimit.RetryAfter))
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.WriteHeader(429)
+	removed, deleted, err := DeleteExperiment(expId, ct.TokenId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "deleting experiment failed", "component", "experiment", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "deleting experiment failed")
 		return
 	}
-
-	if r.Method != "GET" {
-		log.Printf("[handler|ratelimit] method '%s' is not GET!\n", r.Method)
-		http.Error(w, "", http.StatusMethodNotAllowed)
+	if !removed {
+		slog.InfoContext(r.Context(), "experiment not found", "component", "experiment", "experiment_id", expId)
+		writeProblem(w, r, http.StatusNotFound, "experiment_not_found", "experiment not found")
 		return
 	}
 
-	content, err := json.Marshal(consumerRateLimit)
-	if err != nil {
-		log.Printf("[handler|ratelimit] marshalling consumer rate limit failed with error: %s\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !deleted {
+		slog.InfoContext(r.Context(), "experiment kept for other owners", "component", "experiment", "experiment_id", expId, "token_id", ct.TokenId)
+		deletion := ExperimentDeletion{ExperimentId: expId}
+		if ttl, err := GetExperimentTTL(expId); err == nil {
+			deletion.ExpiresAt = time.Now().Add(ttl).UTC()
+		}
+		writeExperimentJSON(w, r, deletion)
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json")
-	w.Write(content)
+	slog.InfoContext(r.Context(), "experiment deleted", "component", "experiment", "experiment_id", expId)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func checkIPAddressRateLimit(r *http.Request) (ConsumerRateLimit, error) {
-	var ipAddress, consumerToken string
-	var counter int
-	var err error
-
-	ipAddress = r.Header.Get("X-Real-Ip")
-	if consumerToken = r.FormValue("consumer-token"); len(consumerToken) == 0 {
-		consumerToken = r.Header.Get("Consumer-Token")
+func readExperimentResults(w http.ResponseWriter, r *http.Request, expId string, format ExportFormat, options ExportOptions) []byte {
+	e, ok := loadExperiment(w, r, expId)
+	if !ok {
+		return []byte{}
 	}
 
-	timeNow := time.Now()
-	//	retryTime is time first minute of next hour (timeNow 16:01 -> retryTime 17:00)
-	retryAfter := timeNow.Add(tokenExpiresTime * time.Second).Add(time.Duration((-1) * timeNow.Minute()) * time.Minute)
-	if counter, err = GetRateLimitCounter(ipAddress, timeNow); err != nil {
-		log.Printf("[handler|ratelimit] getting counter for ip address '%s' failed with error: %s\n", ipAddress, err)
-		return ConsumerRateLimit{}, err
+	content, err := format.Exporter.Export(e, options)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exporting experiment failed", "component", "experiment", "experiment_id", expId, "content_type", format.ContentType, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "exporting experiment failed")
+		return []byte{}
 	}
 
-	if counter >= rateLimit {
-		if len(consumerToken) == 0 {
-			log.Printf("[handler|ratelimit] ip address '%s' exceeded the limit!\n", ipAddress)
-			return ConsumerRateLimit{Exceeded: true, Current: counter, Limit: rateLimit, RetryAfter: retryAfter}, nil
-		}
+	exportsTotal.Inc(format.ContentType)
+	slog.DebugContext(r.Context(), "experiment content generated", "component", "experiment", "experiment_id", expId)
 
-		var tokenExists bool
-		if tokenExists, err = GetConsumerToken(consumerToken); err != nil {
-			log.Printf("[handler|ratelimit] getting consumer token '%s' for ip address '%s' failed with error: %s\n", consumerToken, ipAddress, err)
-			return ConsumerRateLimit{}, err
-		}
+	return content
+}
 
-		if !tokenExists {
-			log.Printf("[handler|ratelimit] consumer token '%s' for ip address '%s' is not valid!\n", consumerToken, ipAddress, err)
-			return ConsumerRateLimit{Exceeded: true, Current: counter, Limit: rateLimit, RetryAfter: retryAfter}, nil
-		}
+func rateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	consumerRateLimit := requestRateLimit(r)
+
+	content, err := json.Marshal(consumerRateLimit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling consumer rate limit failed", "component", "ratelimit", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "marshalling consumer rate limit failed")
+		return
 	}
 
-	return ConsumerRateLimit{Exceeded: false, Current: counter, Limit: rateLimit, RetryAfter: retryAfter}, nil
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(content)
 }
 
-func statusHandler(w http.ResponseWriter, r *http.Request) {
-	//	TODO: add redis PING-PONG, disk space check, ...
+//	getConsumerToken returns the consumer token from the query string or the Consumer-Token
+//	header, the body is never parsed as it holds the upload
+func getConsumerToken(r *http.Request) string {
+	if consumerToken := r.URL.Query().Get("consumer-token"); len(consumerToken) > 0 {
+		return consumerToken
+	}
 
-	w.WriteHeader(http.StatusOK)
+	return r.Header.Get("Consumer-Token")
 }
 
+//	authenticateConsumer returns the consumer token of the request, it responds with
+//	401 when the token is missing, unknown or expired
+func authenticateConsumer(w http.ResponseWriter, r *http.Request) (ConsumerToken, bool) {
+	consumerToken := getConsumerToken(r)
+	if len(consumerToken) == 0 {
+		slog.InfoContext(r.Context(), "request without consumer token", "component", "auth", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusUnauthorized, "missing_consumer_token", "request without consumer token")
+		return ConsumerToken{}, false
+	}
 
+	ct, err := GetConsumerToken(consumerToken)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "consumer token is not valid", "component", "auth", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusUnauthorized, "invalid_consumer_token", "consumer token is not valid")
+		return ConsumerToken{}, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting consumer token failed", "component", "auth", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting consumer token failed")
+		return ConsumerToken{}, false
+	}
 
+	return ct, true
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//	adminTokenEnv names the environment variable holding the admin token, the admin
+//	API is disabled when it is not set
+const (
+	adminTokenEnv = "QPCRBOX_ADMIN_TOKEN"
+)
+
+type TokenRequest struct {
+	Owner, ExpiresIn, CallbackUrl string
+	Limits           TokenLimits
+}
+
+type TokensResponse struct {
+	Tokens []ConsumerToken
+}
+
+//	adminTokensHandler manages consumer tokens:
+//
+//	/v1/admin/tokens                 GET (list), POST (issue)
+//	/v1/admin/tokens/{id}            GET (describe), DELETE (revoke)
+//	/v1/admin/tokens/{id}/rotate     POST
+func adminTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		slog.WarnContext(r.Context(), "request is not authorized", "component", "admin", "path", r.URL.Path)
+		w.Header().Add("WWW-Authenticate", "Bearer")
+		writeProblem(w, r, http.StatusUnauthorized, "unauthorized", "request is not authorized")
+		return
+	}
+
+	urlPath := strings.Split(strings.TrimSuffix(r.URL.Path[1:], "/"), "/")
+	switch {
+	case len(urlPath) == 3 && r.Method == "GET":
+		listTokens(w, r)
+	case len(urlPath) == 3 && r.Method == "POST":
+		issueToken(w, r)
+	case len(urlPath) == 4 && r.Method == "GET":
+		describeToken(w, r, urlPath[3])
+	case len(urlPath) == 4 && r.Method == "DELETE":
+		revokeToken(w, r, urlPath[3])
+	case len(urlPath) == 5 && urlPath[4] == "rotate" && r.Method == "POST":
+		rotateToken(w, r, urlPath[3])
+	case len(urlPath) >= 3 && len(urlPath) <= 5:
+		slog.WarnContext(r.Context(), "method is not valid", "component", "admin", "method", r.Method, "path", r.URL.Path)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method is not valid")
+	default:
+		slog.WarnContext(r.Context(), "path is not valid", "component", "admin", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusNotFound, "not_found", "path is not valid")
+	}
+}
+
+func listTokens(w http.ResponseWriter, r *http.Request) {
+	tokenIds, err := GetConsumerTokenIds()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting token ids failed", "component", "admin", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting token ids failed")
+		return
+	}
+
+	response := TokensResponse{Tokens: []ConsumerToken{}}
+	for _, tokenId := range tokenIds {
+		ct, _, err := GetConsumerTokenById(tokenId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "getting token failed", "component", "admin", "token_id", tokenId, "error", err)
+			continue
+		}
+		response.Tokens = append(response.Tokens, ct)
+	}
+
+	writeAdminJSON(w, http.StatusOK, response)
+}
+
+func issueToken(w http.ResponseWriter, r *http.Request) {
+	var request TokenRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&request); err != nil {
+		slog.WarnContext(r.Context(), "body is not valid token json", "component", "admin", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_json", err.Error())
+		return
+	}
+
+	expiresIn, err := parseTokenRequest(request)
+	if err != nil {
+		slog.WarnContext(r.Context(), "token request is not valid", "component", "admin", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_token_request", err.Error())
+		return
+	}
+
+	issued, err := IssueConsumerToken(request.Owner, expiresIn, request.Limits, request.CallbackUrl)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "issuing token failed", "component", "admin", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "issuing token failed")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "token issued", "component", "admin", "token_id", issued.TokenId, "owner", issued.Owner)
+	w.Header().Add("Location", "/v1/admin/tokens/"+issued.TokenId)
+	writeAdminJSON(w, http.StatusCreated, issued)
+}
+
+func describeToken(w http.ResponseWriter, r *http.Request, tokenId string) {
+	ct, _, err := GetConsumerTokenById(tokenId)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "token not found", "component", "admin", "token_id", tokenId)
+		writeProblem(w, r, http.StatusNotFound, "token_not_found", "token not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting token failed", "component", "admin", "token_id", tokenId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting token failed")
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, ct)
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request, tokenId string) {
+	revoked, err := RevokeConsumerToken(tokenId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "revoking token failed", "component", "admin", "token_id", tokenId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "revoking token failed")
+		return
+	}
+	if !revoked {
+		slog.InfoContext(r.Context(), "token not found", "component", "admin", "token_id", tokenId)
+		writeProblem(w, r, http.StatusNotFound, "token_not_found", "token not found")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "token revoked", "component", "admin", "token_id", tokenId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func rotateToken(w http.ResponseWriter, r *http.Request, tokenId string) {
+	issued, err := RotateConsumerToken(tokenId)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "token not found", "component", "admin", "token_id", tokenId)
+		writeProblem(w, r, http.StatusNotFound, "token_not_found", "token not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rotating token failed", "component", "admin", "token_id", tokenId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "rotating token failed")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "token rotated", "component", "admin", "token_id", tokenId)
+	writeAdminJSON(w, http.StatusOK, issued)
+}
+
+//	isAdmin checks the bearer token of the request against the configured admin token
+func isAdmin(r *http.Request) bool {
+	adminToken := os.Getenv(adminTokenEnv)
+	if len(adminToken) == 0 {
+		return false
+	}
+
+	bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(adminToken)) == 1
+}
+
+func parseTokenRequest(request TokenRequest) (time.Duration, error) {
+	if len(strings.TrimSpace(request.Owner)) == 0 {
+		return 0, errors.New("owner is missing")
+	}
+	for _, limit := range []int64{int64(request.Limits.RequestsPerHour), int64(request.Limits.RequestsBurst), int64(request.Limits.UploadsPerDay), int64(request.Limits.MaxExperiments), request.Limits.MaxUploadSize} {
+		if limit < unlimitedLimit {
+			return 0, errors.New("limits can not be negative, -1 is unlimited")
+		}
+	}
+	if len(request.CallbackUrl) > 0 {
+		if _, err := parseCallbackUrl(request.CallbackUrl); err != nil {
+			return 0, err
+		}
+	}
+	if len(request.ExpiresIn) == 0 {
+		return 0, nil
+	}
+
+	expiresIn, err := time.ParseDuration(request.ExpiresIn)
+	if err != nil || expiresIn < 0 {
+		return 0, errors.New("expiration '" + request.ExpiresIn + "' is not valid")
+	}
+
+	return expiresIn, nil
+}
+
+//	writeAdminJSON writes v as json response, the project handlers use it too
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("marshalling response failed", "component", "admin", "error", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
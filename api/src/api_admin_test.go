@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsAdmin(t *testing.T) {
+	for _, tc := range []struct {
+		adminToken, authorization string
+		admin                     bool
+	}{
+		{"", "", false},
+		{"", "Bearer ", false},
+		{"s3cret", "Bearer s3cret", true},
+		{"s3cret", "Bearer s3cre", false},
+		{"s3cret", "Bearer s3cret2", false},
+		{"s3cret", "s3cret", false},
+		{"s3cret", "Basic s3cret", false},
+		{"s3cret", "", false},
+	} {
+		t.Setenv(adminTokenEnv, tc.adminToken)
+		r := httptest.NewRequest("GET", "/v1/admin/tokens", nil)
+		r.Header.Set("Authorization", tc.authorization)
+		if isAdmin(r) != tc.admin {
+			t.Errorf("Admin token '%s' with Authorization '%s' should be admin %v", tc.adminToken, tc.authorization, tc.admin)
+		}
+	}
+}
+
+func TestParseTokenRequest(t *testing.T) {
+	for _, tc := range []struct {
+		request TokenRequest
+		valid   bool
+	}{
+		{TokenRequest{Owner: "lab"}, true},
+		{TokenRequest{Owner: "lab", ExpiresIn: "720h"}, true},
+		{TokenRequest{Owner: "lab", CallbackUrl: "https://203.0.113.10/hook"}, true},
+		{TokenRequest{Owner: "lab", Limits: TokenLimits{RequestsPerHour: 10, MaxUploadSize: 1 << 20}}, true},
+		{TokenRequest{Owner: "lab", Limits: TokenLimits{UploadsPerDay: unlimitedLimit, MaxUploadSize: unlimitedLimit}}, true},
+		{TokenRequest{}, false},
+		{TokenRequest{Owner: "  "}, false},
+		{TokenRequest{Owner: "lab", ExpiresIn: "a month"}, false},
+		{TokenRequest{Owner: "lab", ExpiresIn: "-1h"}, false},
+		{TokenRequest{Owner: "lab", CallbackUrl: "ftp://203.0.113.10/hook"}, false},
+		{TokenRequest{Owner: "lab", CallbackUrl: "/hook"}, false},
+		{TokenRequest{Owner: "lab", Limits: TokenLimits{UploadsPerDay: -2}}, false},
+	} {
+		if _, err := parseTokenRequest(tc.request); (err == nil) != tc.valid {
+			t.Errorf("Token request %+v should be valid %v, got %v", tc.request, tc.valid, err)
+		}
+	}
+}
+
+func TestAdminTokensHandler(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+	t.Setenv(adminTokenEnv, "s3cret")
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		r.Header.Set("Authorization", "Bearer s3cret")
+		w := httptest.NewRecorder()
+		adminTokensHandler(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	adminTokensHandler(w, httptest.NewRequest("GET", "/v1/admin/tokens", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Request without admin token should be 401, got %d", w.Code)
+	}
+
+	if w = serve("POST", "/v1/admin/tokens", `{"Owner": ""}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Token without owner should be 400, got %d", w.Code)
+	}
+	if w = serve("POST", "/v1/admin/tokens", `{"Owner": `); w.Code != http.StatusBadRequest {
+		t.Errorf("Token request which is not json should be 400, got %d", w.Code)
+	}
+
+	w = serve("POST", "/v1/admin/tokens", `{"Owner": "lab", "ExpiresIn": "24h"}`)
+	var issued IssuedConsumerToken
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); w.Code != http.StatusCreated || err != nil || len(issued.Token) == 0 {
+		t.Fatalf("Token should be issued, got %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Location") != "/v1/admin/tokens/"+issued.TokenId {
+		t.Errorf("Location should point to the token, got '%s'", w.Header().Get("Location"))
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/v1/admin/tokens", http.StatusOK},
+		{"GET", "/v1/admin/tokens/" + issued.TokenId, http.StatusOK},
+		{"POST", "/v1/admin/tokens/" + issued.TokenId + "/rotate", http.StatusOK},
+		{"PUT", "/v1/admin/tokens/" + issued.TokenId, http.StatusMethodNotAllowed},
+		{"GET", "/v1/admin/tokens/" + issued.TokenId + "/rotate/now", http.StatusNotFound},
+		{"DELETE", "/v1/admin/tokens/" + issued.TokenId, http.StatusNoContent},
+		{"GET", "/v1/admin/tokens/" + issued.TokenId, http.StatusNotFound},
+		{"DELETE", "/v1/admin/tokens/" + issued.TokenId, http.StatusNotFound},
+		{"POST", "/v1/admin/tokens/" + issued.TokenId + "/rotate", http.StatusNotFound},
+	} {
+		if w = serve(tc.method, tc.path, ""); w.Code != tc.status {
+			t.Errorf("%s %s should be %d, got %d %s", tc.method, tc.path, tc.status, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	experimentsDefaultPerPage = 20
+	experimentsMaxPerPage     = 100
+)
+
+type ExperimentMeta struct {
+	ExperimentId, Instrument, Filename, Calibrator string
+	UploadedAt, ExpiresAt                          time.Time
+	DetectorCount, SampleCount                     int
+	Detectors, Samples                             []string
+}
+
+type ExperimentsResponse struct {
+	Experiments          []ExperimentMeta
+	Page, PerPage, Total int
+}
+
+//	newExperimentMeta collects the metadata of a computed experiment, id and
+//	expiration are set when the experiment is saved
+func newExperimentMeta(e *Experiment, filename string) *ExperimentMeta {
+	detectors := make(map[string]bool)
+	samples := make(map[string]bool)
+	for detectorName, detector := range e.Detectors {
+		detectors[detectorName] = true
+		for sampleName := range detector {
+			samples[sampleName] = true
+		}
+	}
+	for sampleName, endoTargetGene := range e.EndogenousControls {
+		samples[sampleName] = true
+		for detectorName := range endoTargetGene.Detectors {
+			detectors[detectorName] = true
+		}
+	}
+
+	meta := &ExperimentMeta{Instrument: e.Instrument, Filename: filename, Calibrator: e.Calibrator, UploadedAt: time.Now().UTC()}
+	meta.Detectors = sortedKeys(detectors)
+	meta.Samples = sortedKeys(samples)
+	meta.DetectorCount = len(meta.Detectors)
+	meta.SampleCount = len(meta.Samples)
+
+	return meta
+}
+
+//	getUploadFilename returns the original filename from the filename query parameter
+//	or the Content-Disposition header of the upload
+func getUploadFilename(r *http.Request) string {
+	if filename := r.URL.Query().Get("filename"); len(filename) > 0 {
+		return filename
+	}
+
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+		return params["filename"]
+	}
+
+	return ""
+}
+
+func experimentsHandler(w http.ResponseWriter, r *http.Request) {
+	ct, ok := authenticateConsumer(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := parseDateRange(query.Get("from"), query.Get("to"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "date range is not valid", "component", "experiments", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_date_range", err.Error())
+		return
+	}
+
+	page, perPage, err := parsePagination(query.Get("page"), query.Get("per_page"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "pagination is not valid", "component", "experiments", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return
+	}
+
+	expIds, err := GetOwnerExperimentIds(ct.TokenId, from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment ids failed", "component", "experiments", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment ids failed")
+		return
+	}
+
+	instrument, detector := strings.ToLower(query.Get("instrument")), query.Get("detector")
+	experiments := []ExperimentMeta{}
+	for _, expId := range expIds {
+		meta, err := GetExperimentMeta(expId, ct.TokenId)
+		if err != nil {
+			slog.WarnContext(r.Context(), "getting experiment metadata failed", "component", "experiments", "experiment_id", expId, "error", err)
+			continue
+		}
+
+		if len(instrument) > 0 && meta.Instrument != instrument {
+			continue
+		}
+		if len(detector) > 0 && !containsString(meta.Detectors, detector) {
+			continue
+		}
+
+		experiments = append(experiments, meta)
+	}
+
+	response := ExperimentsResponse{Page: page, PerPage: perPage, Total: len(experiments)}
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(experiments) {
+		start = len(experiments)
+	}
+	if end > len(experiments) {
+		end = len(experiments)
+	}
+	response.Experiments = experiments[start:end]
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling experiments failed", "component", "experiments", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "marshalling experiments failed")
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(content)
+}
+
+//	parseDateRange parses RFC 3339 timestamps or plain dates, a plain date in to
+//	covers the whole day. Missing bounds leave the range open.
+func parseDateRange(fromValue, toValue string) (time.Time, time.Time, error) {
+	from, to := time.Unix(0, 0), time.Now().Add(time.Hour)
+
+	if len(fromValue) > 0 {
+		t, err := parseDate(fromValue, false)
+		if err != nil {
+			return from, to, err
+		}
+		from = t
+	}
+
+	if len(toValue) > 0 {
+		t, err := parseDate(toValue, true)
+		if err != nil {
+			return from, to, err
+		}
+		to = t
+	}
+
+	if to.Before(from) {
+		return from, to, fmt.Errorf("date range from '%s' to '%s' is empty", fromValue, toValue)
+	}
+
+	return from, to, nil
+}
+
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("date '%s' is not valid", value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+
+	return t, nil
+}
+
+func parsePagination(pageValue, perPageValue string) (int, int, error) {
+	page, perPage := 1, experimentsDefaultPerPage
+
+	if len(pageValue) > 0 {
+		p, err := strconv.Atoi(pageValue)
+		if err != nil || p < 1 {
+			return page, perPage, fmt.Errorf("page '%s' is not valid", pageValue)
+		}
+		page = p
+	}
+
+	if len(perPageValue) > 0 {
+		pp, err := strconv.Atoi(perPageValue)
+		if err != nil || pp < 1 || pp > experimentsMaxPerPage {
+			return page, perPage, fmt.Errorf("per_page '%s' is not valid", perPageValue)
+		}
+		perPage = pp
+	}
+
+	//	the offset of the page has to fit an int
+	if page > math.MaxInt/perPage {
+		return page, perPage, fmt.Errorf("page '%s' is out of range", pageValue)
+	}
+
+	return page, perPage, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make(StringArrayMap, len(m))
+	for key := range m {
+		keys[key] = nil
+	}
+
+	return keys.Names()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExperimentMetaCounts(t *testing.T) {
+	e := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	e.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+	e.addDetectorTargetGeneValue("Treated", "GAPDH", "22.5")
+	e.addDetectorTargetGeneValue("Treated", "ACTB", "24.1")
+	e.addEndogenousControlTargetGeneValue("Mock", "18S", "12.0")
+
+	meta := newExperimentMeta(e, "run.csv")
+	if meta.DetectorCount != 3 || meta.SampleCount != 2 {
+		t.Errorf("Expected 3 detectors and 2 samples, got %d and %d!", meta.DetectorCount, meta.SampleCount)
+	}
+	if meta.Detectors[0] != "18S" || meta.Filename != "run.csv" {
+		t.Errorf("Metadata %+v is not valid!", meta)
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	from, to, err := parseDateRange("2013-01-01", "2013-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.Sub(from).Hours() < 23 {
+		t.Errorf("Date range %s - %s does not cover the whole day!", from, to)
+	}
+
+	if _, _, err = parseDateRange("2013-01-02", "2013-01-01"); err == nil {
+		t.Error("Empty date range did not fail!")
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	for _, tc := range []struct {
+		page, perPage string
+		valid         bool
+	}{
+		{"", "", true},
+		{"3", "50", true},
+		{strconv.Itoa(math.MaxInt / experimentsMaxPerPage), "100", true},
+		{"0", "", false},
+		{"", "101", false},
+		{"two", "", false},
+		{strconv.Itoa(math.MaxInt), "", false},
+		{strconv.Itoa(math.MaxInt/experimentsMaxPerPage + 1), "100", false},
+	} {
+		if _, _, err := parsePagination(tc.page, tc.perPage); (err == nil) != tc.valid {
+			t.Errorf("Page '%s' of %s should be valid %v, got %v", tc.page, tc.perPage, tc.valid, err)
+		}
+	}
+}
+
+func TestExperimentsHandlerPageOutOfRange(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	issued, err := IssueConsumerToken("lab", 0, TokenLimits{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/experiments?page="+strconv.Itoa(math.MaxInt), nil)
+	r.Header.Set("Consumer-Token", issued.Token)
+	experimentsHandler(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_pagination") {
+		t.Errorf("Page out of range should be 400 invalid_pagination, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSaveExperimentMetaPerOwner(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	newUpload := func(filename string) (*Experiment, *ExperimentMeta) {
+		e := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+		e.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+		meta := newExperimentMeta(e, filename)
+		meta.UploadedAt = time.Now().UTC()
+		return e, meta
+	}
+
+	e, meta := newUpload("lab-a.csv")
+	expId, created, expiresAt, err := SaveExperiment(e, []byte("source"), meta, "token-a")
+	if err != nil || !created {
+		t.Fatalf("First upload should create the experiment, got %t %v", created, err)
+	}
+	if !expiresAt.Equal(meta.UploadedAt.Add(expirimentExpiresTime*time.Second)) || !expiresAt.Equal(meta.ExpiresAt) {
+		t.Errorf("Saved experiment should expire with its time to live, got %s", expiresAt)
+	}
+	e, meta = newUpload("lab-b.csv")
+	if _, created, _, err = SaveExperiment(e, []byte("source"), meta, "token-b"); err != nil || created {
+		t.Fatalf("Second upload should reuse the experiment, got %t %v", created, err)
+	}
+
+	for owner, filename := range map[string]string{"token-a": "lab-a.csv", "token-b": "lab-b.csv"} {
+		if meta, err := GetExperimentMeta(expId, owner); err != nil || meta.Filename != filename || meta.ExperimentId != expId {
+			t.Errorf("Metadata of %s should have filename %s, got %+v %v", owner, filename, meta, err)
+		}
+	}
+	if _, err = GetExperimentMeta(expId, ""); err == nil {
+		t.Error("Uploads of tokens should not leave anonymous metadata!")
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v2/experiments/"+expId+"/source", nil)
+	r.SetPathValue("id", expId)
+	experimentSourceHandler(w, r)
+	if disposition := w.Header().Get("Content-Disposition"); w.Code != http.StatusOK || strings.Contains(disposition, "lab-") {
+		t.Errorf("Source should not be named after another uploader's file, got %d '%s'", w.Code, disposition)
+	}
+}
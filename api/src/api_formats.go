@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+//	FormatsResponse lists the registered export formats, the options of a format can be
+//	changed with the precision, locale and raw-values query parameters
+type FormatsResponse struct {
+	Default, ProjectDefault string
+	Formats                 []FormatDescription
+}
+
+type FormatDescription struct {
+	Extension, ContentType, Description string
+	Attachment, ProjectExport           bool
+	Defaults                            ExportOptions
+}
+
+//	formatsHandler lists the export formats:
+//
+//	/v1/formats    GET
+func formatsHandler(w http.ResponseWriter, r *http.Request) {
+	response := FormatsResponse{Default: defaultExportFormat, ProjectDefault: defaultProjectExportFormat, Formats: []FormatDescription{}}
+	for _, contentType := range exportContentTypes(false) {
+		format, _ := findExportFormatByContentType(contentType)
+		response.Formats = append(response.Formats, FormatDescription{
+			Extension:     format.Extension,
+			ContentType:   format.ContentType,
+			Description:   format.Description,
+			Attachment:    format.Attachment,
+			ProjectExport: format.ProjectExport(),
+			Defaults:      format.Defaults,
+		})
+	}
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling formats failed", "component", "formats", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "marshalling formats failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(content)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	projectNameMaxLength = 200
+)
+
+type Project struct {
+	ProjectId, Name      string
+	CreatedAt, UpdatedAt time.Time
+	ExperimentIds        []string
+}
+
+type ProjectRequest struct {
+	Name string
+}
+
+type ProjectsResponse struct {
+	Projects []Project
+}
+
+//	projectsHandler lists the projects of the consumer token (GET) and creates new ones (POST)
+func projectsHandler(w http.ResponseWriter, r *http.Request) {
+	ct, ok := authenticateConsumer(w, r)
+	if !ok {
+		return
+	}
+	owner := ct.TokenId
+
+	if r.Method == "POST" {
+		name, ok := readProjectName(w, r)
+		if !ok {
+			return
+		}
+
+		projectId, err := randomHex(16)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "generating project id failed", "component", "projects", "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "generating project id failed")
+			return
+		}
+
+		timeNow := time.Now().UTC()
+		p := Project{ProjectId: projectId, Name: name, CreatedAt: timeNow, UpdatedAt: timeNow, ExperimentIds: []string{}}
+		if err = SaveProject(&p, owner); err != nil {
+			slog.ErrorContext(r.Context(), "saving project failed", "component", "projects", "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "saving project failed")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "project created", "component", "projects", "project_id", projectId)
+		w.Header().Add("Location", "/v1/project/"+projectId)
+		writeAdminJSON(w, http.StatusCreated, p)
+		return
+	}
+
+	projectIds, err := GetOwnerProjectIds(owner)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting project ids failed", "component", "projects", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting project ids failed")
+		return
+	}
+
+	response := ProjectsResponse{Projects: []Project{}}
+	for _, projectId := range projectIds {
+		p, err := GetProject(projectId, owner)
+		if err != nil {
+			slog.WarnContext(r.Context(), "getting project failed", "component", "projects", "project_id", projectId, "error", err)
+			continue
+		}
+		response.Projects = append(response.Projects, p)
+	}
+
+	writeAdminJSON(w, http.StatusOK, response)
+}
+
+//	projectHandler serves a single project:
+//
+//	/v1/project/{id}                        GET, PUT (rename), DELETE
+//	/v1/project/{id}/experiments/{expId}    PUT (add), DELETE (remove)
+//	/v1/project/{id}/export                 GET, Accept: csv, ods or xlsx
+func projectHandler(w http.ResponseWriter, r *http.Request) {
+	ct, ok := authenticateConsumer(w, r)
+	if !ok {
+		return
+	}
+	owner := ct.TokenId
+
+	urlPath := strings.Split(r.URL.Path[1:], "/")
+	if len(urlPath) < 3 || len(urlPath[2]) == 0 {
+		slog.WarnContext(r.Context(), "path is not valid", "component", "project", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_path", "path is not valid")
+		return
+	}
+
+	p, err := GetProject(urlPath[2], owner)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "project not found", "component", "project", "project_id", urlPath[2])
+		writeProblem(w, r, http.StatusNotFound, "project_not_found", "project not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting project failed", "component", "project", "project_id", urlPath[2], "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting project failed")
+		return
+	}
+
+	switch {
+	case len(urlPath) == 3:
+		projectResource(w, r, &p, owner)
+	case len(urlPath) == 5 && urlPath[3] == "experiments":
+		projectExperimentResource(w, r, &p, owner, urlPath[4])
+	case len(urlPath) == 4 && urlPath[3] == "export":
+		projectExportResource(w, r, &p)
+	default:
+		slog.WarnContext(r.Context(), "path is not valid", "component", "project", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusNotFound, "not_found", "path is not valid")
+	}
+}
+
+func projectResource(w http.ResponseWriter, r *http.Request, p *Project, owner string) {
+	switch r.Method {
+	case "GET":
+		writeAdminJSON(w, http.StatusOK, p)
+	case "PUT":
+		name, ok := readProjectName(w, r)
+		if !ok {
+			return
+		}
+
+		p.Name, p.UpdatedAt = name, time.Now().UTC()
+		if err := SaveProject(p, owner); err != nil {
+			slog.ErrorContext(r.Context(), "saving project failed", "component", "project", "project_id", p.ProjectId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "saving project failed")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "project renamed", "component", "project", "project_id", p.ProjectId)
+		writeAdminJSON(w, http.StatusOK, p)
+	case "DELETE":
+		if err := DeleteProject(p.ProjectId, owner); err != nil {
+			slog.ErrorContext(r.Context(), "deleting project failed", "component", "project", "project_id", p.ProjectId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "deleting project failed")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "project deleted", "component", "project", "project_id", p.ProjectId)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		slog.WarnContext(r.Context(), "method is not GET, PUT or DELETE", "component", "project", "method", r.Method)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method is not GET, PUT or DELETE")
+	}
+}
+
+//	projectExperimentResource adds experiments uploaded by the consumer token to the
+//	project (PUT) and removes them (DELETE)
+func projectExperimentResource(w http.ResponseWriter, r *http.Request, p *Project, owner, expId string) {
+	switch r.Method {
+	case "PUT":
+		exists, err := ExperimentExists(expId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "checking experiment failed", "component", "project", "experiment_id", expId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "checking experiment failed")
+			return
+		}
+		if !exists {
+			slog.InfoContext(r.Context(), "experiment not found", "component", "project", "experiment_id", expId)
+			writeProblem(w, r, http.StatusNotFound, "experiment_not_found", "experiment not found")
+			return
+		}
+
+		owned, err := IsExperimentOwner(expId, owner)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "getting experiment owner failed", "component", "project", "experiment_id", expId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment owner failed")
+			return
+		}
+		if !owned {
+			slog.WarnContext(r.Context(), "experiment is not owned by the consumer token", "component", "project", "experiment_id", expId, "token_id", owner)
+			writeProblem(w, r, http.StatusForbidden, "not_owner", "experiment is not owned by the consumer token")
+			return
+		}
+
+		if err = AddProjectExperiment(p.ProjectId, expId); err != nil {
+			slog.ErrorContext(r.Context(), "adding experiment to project failed", "component", "project", "project_id", p.ProjectId, "experiment_id", expId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "adding experiment to project failed")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "experiment added to project", "component", "project", "project_id", p.ProjectId, "experiment_id", expId)
+	case "DELETE":
+		removed, err := RemoveProjectExperiment(p.ProjectId, expId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "removing experiment from project failed", "component", "project", "project_id", p.ProjectId, "experiment_id", expId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "removing experiment from project failed")
+			return
+		}
+		if !removed {
+			slog.InfoContext(r.Context(), "experiment is not part of project", "component", "project", "project_id", p.ProjectId, "experiment_id", expId)
+			writeProblem(w, r, http.StatusNotFound, "experiment_not_in_project", "experiment is not part of project")
+			return
+		}
+
+		slog.InfoContext(r.Context(), "experiment removed from project", "component", "project", "project_id", p.ProjectId, "experiment_id", expId)
+	default:
+		slog.WarnContext(r.Context(), "method is not PUT or DELETE", "component", "project", "method", r.Method)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method is not PUT or DELETE")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//	projectExportResource exports all project experiments into one document, experiments
+//	which already expired are left out
+func projectExportResource(w http.ResponseWriter, r *http.Request, p *Project) {
+	if r.Method != "GET" {
+		slog.WarnContext(r.Context(), "method is not GET", "component", "project", "method", r.Method)
+		writeProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method is not GET")
+		return
+	}
+
+	format, ok := requestExportFormat(w, r, "", exportContentTypes(true))
+	if !ok {
+		return
+	}
+	options, ok := requestExportOptions(w, r, format.Defaults)
+	if !ok {
+		return
+	}
+	ex, ok := format.Exporter.(ProjectExporter)
+	if !ok {
+		slog.WarnContext(r.Context(), "format does not export projects", "component", "project", "content_type", format.ContentType)
+		writeProblem(w, r, http.StatusNotAcceptable, "not_acceptable", fmt.Sprintf("format '%s' does not export projects", format.ContentType))
+		return
+	}
+
+	experiments := []ProjectExperiment{}
+	for _, expId := range p.ExperimentIds {
+		expBytes, err := GetExperiment(expId)
+		if err != nil {
+			slog.InfoContext(r.Context(), "experiment not found, skipping", "component", "project", "project_id", p.ProjectId, "experiment_id", expId)
+			continue
+		}
+
+		var e Experiment
+		if err = json.Unmarshal(expBytes, &e); err != nil {
+			slog.ErrorContext(r.Context(), "parsing experiment failed", "component", "project", "experiment_id", expId, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "parsing experiment failed")
+			return
+		}
+		experiments = append(experiments, ProjectExperiment{ExperimentId: expId, Experiment: &e})
+	}
+
+	content, err := ex.ExportProject(experiments, options)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "exporting project failed", "component", "project", "project_id", p.ProjectId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "exporting project failed")
+		return
+	}
+
+	exportsTotal.Inc(format.ContentType)
+	slog.InfoContext(r.Context(), "project exported", "component", "project", "project_id", p.ProjectId, "content_type", format.ContentType)
+	w.Header().Add("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", attachmentDisposition(p.Name, format))
+	w.Write(content)
+}
+
+func readProjectName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var request ProjectRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&request); err != nil {
+		slog.WarnContext(r.Context(), "body is not valid project json", "component", "project", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_json", "body is not valid project json")
+		return "", false
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if len(name) == 0 || len(name) > projectNameMaxLength {
+		slog.WarnContext(r.Context(), "project name is not valid", "component", "project", "name", name)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_project_name", "project name is not valid")
+		return "", false
+	}
+
+	return name, true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//	issueTestToken issues a consumer token and returns the token with its id
+func issueTestToken(t *testing.T) (string, string) {
+	issued, err := IssueConsumerToken("lab", 0, TokenLimits{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return issued.Token, issued.TokenId
+}
+
+func projectRequest(handler http.HandlerFunc, method, target, token, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if len(token) > 0 {
+		r.Header.Set("Consumer-Token", token)
+	}
+	if method == "GET" {
+		r.Header.Set("Accept", "text/csv")
+	}
+	handler(w, r)
+
+	return w
+}
+
+func TestProjects(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	token, tokenId := issueTestToken(t)
+	otherToken, otherTokenId := issueTestToken(t)
+
+	e := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	e.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+	e.addEndogenousControlTargetGeneValue("Mock", "18S", "12.0")
+	expId, _, _, err := SaveExperiment(e, []byte("source"), newExperimentMeta(e, "lab.csv"), tokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.addDetectorTargetGeneValue("Sample", "GAPDH", "23.5")
+	otherExpId, _, _, err := SaveExperiment(e, []byte("other source"), newExperimentMeta(e, "other.csv"), otherTokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := projectRequest(projectsHandler, "POST", "/v1/projects", "", `{"Name": "Study"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Create without token should be 401, got %d", w.Code)
+	}
+	if w := projectRequest(projectsHandler, "POST", "/v1/projects", token, `{"Name": " "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Create without name should be 400, got %d", w.Code)
+	}
+
+	w := projectRequest(projectsHandler, "POST", "/v1/projects", token, `{"Name": " Study "}`)
+	var p Project
+	if err = json.Unmarshal(w.Body.Bytes(), &p); w.Code != http.StatusCreated || err != nil || p.Name != "Study" || len(p.ProjectId) != 32 {
+		t.Fatalf("Create should be 201 with the project, got %d '%s'", w.Code, w.Body.String())
+	}
+	if location := w.Header().Get("Location"); location != "/v1/project/"+p.ProjectId {
+		t.Errorf("Create should set the Location of the project, got '%s'", location)
+	}
+	projectPath := "/v1/project/" + p.ProjectId
+
+	if w = projectRequest(projectHandler, "PUT", projectPath+"/experiments/"+expId, token, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Adding an owned experiment should be 204, got %d '%s'", w.Code, w.Body.String())
+	}
+	if w = projectRequest(projectHandler, "PUT", projectPath+"/experiments/"+otherExpId, token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Adding an experiment of another token should be 403, got %d", w.Code)
+	}
+	if w = projectRequest(projectHandler, "PUT", projectPath+"/experiments/unknown", token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Adding an unknown experiment should be 404, got %d", w.Code)
+	}
+
+	w = projectRequest(projectsHandler, "GET", "/v1/projects", token, "")
+	var projects ProjectsResponse
+	if err = json.Unmarshal(w.Body.Bytes(), &projects); w.Code != http.StatusOK || err != nil || len(projects.Projects) != 1 {
+		t.Fatalf("List should be 200 with the project, got %d '%s'", w.Code, w.Body.String())
+	}
+	if ids := projects.Projects[0].ExperimentIds; len(ids) != 1 || ids[0] != expId {
+		t.Errorf("Listed project should contain the added experiment, got %v", ids)
+	}
+	if w = projectRequest(projectsHandler, "GET", "/v1/projects", otherToken, ""); !strings.Contains(w.Body.String(), `"Projects":[]`) {
+		t.Errorf("List of another token should be empty, got %d '%s'", w.Code, w.Body.String())
+	}
+
+	w = projectRequest(projectHandler, "GET", projectPath+"/export", token, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" || !strings.Contains(w.Body.String(), expId) {
+		t.Errorf("Export should be 200 csv with the experiment, got %d '%s'", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "Study") {
+		t.Errorf("Export should be named after the project, got '%s'", w.Header().Get("Content-Disposition"))
+	}
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		if w = projectRequest(projectHandler, method, projectPath, otherToken, `{"Name": "Mine"}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s of a project of another token should be 404, got %d", method, w.Code)
+		}
+	}
+	if w = projectRequest(projectHandler, "GET", projectPath+"/export", otherToken, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Export of a project of another token should be 404, got %d", w.Code)
+	}
+
+	if w = projectRequest(projectHandler, "DELETE", projectPath, token, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Delete should be 204, got %d", w.Code)
+	}
+	if w = projectRequest(projectHandler, "GET", projectPath, token, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Deleted project should be 404, got %d", w.Code)
+	}
+}
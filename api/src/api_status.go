@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+const (
+	storageCheckTimeout = 2 * time.Second
+)
+
+var (
+	//	version is set at build time with -ldflags "-X main.version=..."
+	version   = "dev"
+	startedAt = time.Now()
+)
+
+type StatusResponse struct {
+	Status, Version      string
+	StartedAt            time.Time
+	Uptime               string
+	Runtime              RuntimeStatus
+	Checks               map[string]CheckStatus
+	Instruments, Formats []string
+}
+
+type RuntimeStatus struct {
+	GoVersion                      string
+	Goroutines, CPUs               int
+	HeapAlloc, HeapSys, TotalAlloc uint64
+	NumGC                          uint32
+}
+
+type CheckStatus struct {
+	Status, Latency, Error string
+}
+
+//	statusHandler is the liveness probe, it reports dependencies but responds with
+//	200 as long as the process serves requests
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, r, false)
+}
+
+//	readyHandler is the readiness probe, it responds with 503 when a dependency is down
+//	or the server is shutting down
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, r, true)
+}
+
+func writeStatus(w http.ResponseWriter, r *http.Request, readiness bool) {
+	response := StatusResponse{
+		Status:      "ok",
+		Version:     version,
+		StartedAt:   startedAt.UTC(),
+		Uptime:      time.Since(startedAt).Round(time.Second).String(),
+		Runtime:     runtimeStatus(),
+		Checks:      map[string]CheckStatus{"storage": checkStorage()},
+		Instruments: instrumentNames(),
+		Formats:     []string{},
+	}
+	response.Formats = append(response.Formats, exportContentTypes(false)...)
+
+	status := http.StatusOK
+	if shuttingDown.Load() {
+		response.Status = "shutting_down"
+		if readiness {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	for name, check := range response.Checks {
+		if check.Status != "ok" {
+			slog.WarnContext(r.Context(), "check failed", "component", "status", "check", name, "error", check.Error)
+			if response.Status == "ok" {
+				response.Status = "unavailable"
+			}
+			if readiness {
+				status = http.StatusServiceUnavailable
+			}
+		}
+	}
+
+	content, err := json.Marshal(response)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling status failed", "component", "status", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "marshalling status failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		w.Write(content)
+	}
+}
+
+func checkStorage() CheckStatus {
+	latency, err := PingRedis(storageCheckTimeout)
+	if err != nil {
+		return CheckStatus{Status: "down", Error: err.Error()}
+	}
+
+	return CheckStatus{Status: "ok", Latency: latency.String()}
+}
+
+func runtimeStatus() RuntimeStatus {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return RuntimeStatus{
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		CPUs:       runtime.NumCPU(),
+		HeapAlloc:  ms.HeapAlloc,
+		HeapSys:    ms.HeapSys,
+		TotalAlloc: ms.TotalAlloc,
+		NumGC:      ms.NumGC,
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestReadinessWithStorageDown(t *testing.T) {
+	redisPool = &redis.Pool{Dial: func() (redis.Conn, error) { return nil, errors.New("connection refused") }}
+	defer func() { redisPool = nil }()
+
+	w := httptest.NewRecorder()
+	readyHandler(w, httptest.NewRequest("GET", "/v1/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readiness with storage down should be 503, got %d!", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	statusHandler(w, httptest.NewRequest("GET", "/v1/status", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Liveness with storage down should be 200, got %d!", w.Code)
+	}
+}
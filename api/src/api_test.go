@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//	storeTestExperiment saves a computed experiment in the fake redis under the id
+func storeTestExperiment(t *testing.T, expId string) {
+	e := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	e.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+	e.addEndogenousControlTargetGeneValue("Mock", "18S", "12.0")
+
+	content, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = persist(expId, string(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExperimentDownloadCaching(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+	storeTestExperiment(t, "abc")
+
+	get := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/v1/experiment/abc", nil)
+		r.Header.Set("Accept", "application/json")
+		if len(ifNoneMatch) > 0 {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		experimentHandler(w, r)
+		return w
+	}
+
+	w := get("GET", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.Len() == 0 || !strings.HasPrefix(etag, `"abc-`) {
+		t.Fatalf("Download should be 200 with an ETag, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Cache-Control") != "private, max-age=7200" {
+		t.Errorf("Download should be cacheable until the experiment expires, got '%s'", w.Header().Get("Cache-Control"))
+	}
+
+	if w = get("GET", `"other", `+etag); w.Code != http.StatusNotModified || w.Body.Len() > 0 || w.Header().Get("ETag") != etag {
+		t.Errorf("Matching If-None-Match should be 304 without body, got %d '%s'", w.Code, w.Body.String())
+	}
+	if w = get("GET", "W/"+etag); w.Code != http.StatusNotModified {
+		t.Errorf("Weak If-None-Match should match too, got %d", w.Code)
+	}
+	if w = get("GET", `"abc-other"`); w.Code != http.StatusOK {
+		t.Errorf("Other If-None-Match should be 200, got %d", w.Code)
+	}
+
+	w = get("HEAD", "")
+	if w.Code != http.StatusOK || w.Body.Len() > 0 || w.Header().Get("Content-Length") == "0" || w.Header().Get("ETag") != etag {
+		t.Errorf("HEAD should be 200 with headers and no body, got %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	experimentHandler(w, httptest.NewRequest("GET", "/v1/experiment/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Unknown experiment should be 404, got %d", w.Code)
+	}
+}
+
+func TestExperimentETagVersion(t *testing.T) {
+	format, _ := findExportFormatByContentType("text/csv")
+	etag := experimentETag("abc", format, format.Defaults)
+
+	format.Version++
+	if experimentETag("abc", format, format.Defaults) == etag {
+		t.Error("ETag should change with the exporter version!")
+	}
+	format.Version--
+	if experimentETag("abc", format, ExportOptions{Precision: 2}) == etag {
+		t.Error("ETag should change with the export options!")
+	}
+}
+
+func TestExperimentDownloadVaryKeepsOrigin(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+	storeTestExperiment(t, "abc")
+
+	defaultOrigins := corsConfig.AllowedOrigins
+	corsConfig.AllowedOrigins = parseOrigins("https://www.qpcrbox.com")
+	rateLimiter = newMemoryRateLimiter()
+	defer func() { corsConfig.AllowedOrigins, rateLimiter = defaultOrigins, nil }()
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/experiment/abc", nil)
+	r.RemoteAddr = "192.0.2.1:4000"
+	r.Header.Set("Origin", "https://www.qpcrbox.com")
+	mux.ServeHTTP(w, r)
+
+	if vary := strings.Join(w.Header().Values("Vary"), ", "); w.Code != http.StatusOK || vary != "Origin, Accept" {
+		t.Errorf("Download should vary by Origin and Accept, got %d '%s'", w.Code, vary)
+	}
+}
+
+func TestDeleteExperiment(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	tokens := make([]string, 3)
+	for i := range tokens {
+		issued, err := IssueConsumerToken("lab", 0, TokenLimits{}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens[i] = issued.Token
+	}
+
+	e := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	e.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+	var expId string
+	for _, token := range tokens[:2] {
+		ct, err := GetConsumerToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expId, _, _, err = SaveExperiment(e, []byte("source"), newExperimentMeta(e, "lab.csv"), ct.TokenId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	del := func(expId, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("DELETE", "/v1/experiment/"+expId, nil)
+		if len(token) > 0 {
+			r.Header.Set("Consumer-Token", token)
+		}
+		experimentHandler(w, r)
+		return w
+	}
+	exists := func() bool {
+		w := httptest.NewRecorder()
+		experimentHandler(w, httptest.NewRequest("GET", "/v1/experiment/"+expId, nil))
+		return w.Code == http.StatusOK
+	}
+
+	if w := del(expId, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Delete without token should be 401, got %d", w.Code)
+	}
+	if w := del("unknown", tokens[0]); w.Code != http.StatusNotFound {
+		t.Errorf("Delete of unknown experiment should be 404, got %d", w.Code)
+	}
+	if w := del(expId, tokens[2]); w.Code != http.StatusForbidden || !exists() {
+		t.Errorf("Delete by another token should be 403, got %d", w.Code)
+	}
+
+	w := del(expId, tokens[0])
+	var deletion ExperimentDeletion
+	if err := json.Unmarshal(w.Body.Bytes(), &deletion); w.Code != http.StatusOK || err != nil || deletion.Deleted || deletion.ExperimentId != expId {
+		t.Errorf("Delete by one of two owners should be 200 with Deleted false, got %d '%s'", w.Code, w.Body.String())
+	}
+	if !exists() {
+		t.Error("Experiment should stay readable for its other owner!")
+	}
+	if w = del(expId, tokens[0]); w.Code != http.StatusForbidden {
+		t.Errorf("Second delete by the same token should be 403, got %d", w.Code)
+	}
+
+	if w = del(expId, tokens[1]); w.Code != http.StatusNoContent || w.Body.Len() > 0 {
+		t.Errorf("Delete by the last owner should be 204, got %d '%s'", w.Code, w.Body.String())
+	}
+	if exists() {
+		t.Error("Experiment should be gone after its last owner deleted it!")
+	}
+	if w = del(expId, tokens[1]); w.Code != http.StatusNotFound {
+		t.Errorf("Delete of deleted experiment should be 404, got %d", w.Code)
+	}
+}
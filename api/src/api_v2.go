@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//	ExperimentResource is the experiment metadata with links to its sub-resources
+type ExperimentResource struct {
+	ExperimentMeta
+	Links map[string]string
+}
+
+//	QCReport is the quality control of an experiment, Status is warn when a replicate
+//	is flagged or the run file has diagnostics
+type QCReport struct {
+	ExperimentId, Status string
+	Replicates           []ReplicateQC
+	Diagnostics          Diagnostics
+}
+
+//	isV2Request reports whether the request is served by the /v2 api
+func isV2Request(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v2/")
+}
+
+//	experimentPath returns the experiment resource in the api version of the request
+func experimentPath(r *http.Request, expId string) string {
+	if isV2Request(r) {
+		return "/v2/experiments/" + expId
+	}
+
+	return "/v1/experiment/" + expId
+}
+
+//	jobPath returns the job resource in the api version of the request
+func jobPath(r *http.Request, jobId string) string {
+	if isV2Request(r) {
+		return "/v2/jobs/" + jobId
+	}
+
+	return "/v1/jobs/" + jobId
+}
+
+//	experimentsV2Handler lists experiments of the consumer token and computes uploads:
+//
+//	/v2/experiments    GET, POST
+//
+//	The run file is the body with instrument, calibrator and filename query parameters,
+//	or the file part of a multipart/form-data body with the parameters as fields. The
+//	instrument is detected from the run file when it is not set.
+func experimentsV2Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		experimentsHandler(w, r)
+		return
+	}
+
+	consumerRateLimit := requestRateLimit(r)
+	maxUploadSize := uploadSizeLimit(consumerRateLimit)
+
+	var bodyContent []byte
+	var filename string
+	var ok bool
+	params := r.URL.Query()
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		var fields url.Values
+		if bodyContent, filename, fields, ok = readMultipartUpload(w, r, maxUploadSize); !ok {
+			return
+		}
+		for name, values := range fields {
+			params[name] = values
+		}
+	} else if bodyContent, filename, ok = readUpload(w, r, maxUploadSize); !ok {
+		return
+	}
+
+	if uploadFilename := params.Get("filename"); len(uploadFilename) > 0 {
+		filename = uploadFilename
+	} else if uploadFilename := getUploadFilename(r); len(uploadFilename) > 0 {
+		filename = uploadFilename
+	}
+
+	instrument, ok := requestInstrument(w, r, params.Get("instrument"), bodyContent)
+	if !ok {
+		return
+	}
+
+	calibrator := params.Get("calibrator")
+	if len(calibrator) == 0 {
+		slog.WarnContext(r.Context(), "missing calibrator", "component", "experiments", "instrument", instrument.Name)
+		writeProblem(w, r, http.StatusBadRequest, "missing_calibrator", "calibrator parameter is required")
+		return
+	}
+	slog.DebugContext(r.Context(), "experiment computer set", "component", "experiments", "instrument", instrument.Name)
+	uploadsTotal.Inc(instrument.Name)
+
+	uploadExperiment(w, r, consumerRateLimit, instrument.NewComputer(calibrator), instrument.Name, bodyContent, filename)
+}
+
+//	requestInstrument returns the named instrument or detects it from the run file
+func requestInstrument(w http.ResponseWriter, r *http.Request, name string, content []byte) (Instrument, bool) {
+	if len(name) == 0 {
+		instrument, found := detectInstrument(content)
+		if !found {
+			slog.WarnContext(r.Context(), "instrument not detected", "component", "experiments")
+			writeProblem(w, r, http.StatusBadRequest, "unknown_instrument", fmt.Sprintf("instrument parameter is not set and the run file is not one of %s", strings.Join(instrumentNames(), ", ")))
+			return Instrument{}, false
+		}
+		slog.DebugContext(r.Context(), "instrument detected", "component", "experiments", "instrument", instrument.Name)
+		return instrument, true
+	}
+
+	instrument, found := findInstrument(name)
+	if !found {
+		slog.WarnContext(r.Context(), "instrument is not valid", "component", "experiments", "instrument", name)
+		writeProblem(w, r, http.StatusBadRequest, "unknown_instrument", fmt.Sprintf("instrument '%s' is not supported", name))
+		return Instrument{}, false
+	}
+
+	return instrument, true
+}
+
+//	experimentV2Handler serves the experiment metadata and deletes experiments:
+//
+//	/v2/experiments/{id}    GET, HEAD, DELETE
+func experimentV2Handler(w http.ResponseWriter, r *http.Request) {
+	expId := r.PathValue("id")
+	if r.Method == "DELETE" {
+		deleteExperiment(w, r, expId)
+		return
+	}
+
+	ttl, ok := experimentTTL(w, r, expId)
+	if !ok {
+		return
+	}
+
+	meta, err := GetExperimentMeta(expId, requestRateLimit(r).owner())
+	if err == redis.ErrNil {
+		slog.DebugContext(r.Context(), "experiment without metadata", "component", "experiments", "experiment_id", expId)
+		e, ok := loadExperiment(w, r, expId)
+		if !ok {
+			return
+		}
+		meta = *newExperimentMeta(e, "")
+		meta.ExperimentId, meta.UploadedAt, meta.ExpiresAt = expId, time.Time{}, time.Now().Add(ttl).UTC()
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment metadata failed", "component", "experiments", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment metadata failed")
+		return
+	}
+
+	self := experimentPath(r, expId)
+	writeExperimentJSON(w, r, ExperimentResource{ExperimentMeta: meta, Links: map[string]string{
+		"self":    self,
+		"results": self + "/results",
+		"source":  self + "/source",
+		"qc":      self + "/qc",
+	}})
+}
+
+//	experimentResultsHandler exports the experiment in the format of the Accept header:
+//
+//	/v2/experiments/{id}/results    GET, HEAD
+func experimentResultsHandler(w http.ResponseWriter, r *http.Request) {
+	serveExperimentResults(w, r, r.PathValue("id"), "")
+}
+
+//	experimentSourceHandler serves the uploaded run file:
+//
+//	/v2/experiments/{id}/source    GET, HEAD
+func experimentSourceHandler(w http.ResponseWriter, r *http.Request) {
+	expId := r.PathValue("id")
+	ttl, ok := experimentTTL(w, r, expId)
+	if !ok {
+		return
+	}
+
+	etag := fmt.Sprintf("\"%s-source\"", expId)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	source, err := GetExperimentSource(expId)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "experiment source not found", "component", "experiments", "experiment_id", expId)
+		writeProblem(w, r, http.StatusNotFound, "source_not_found", "source of the experiment was not stored")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment source failed", "component", "experiments", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment source failed")
+		return
+	}
+
+	filename := expId + ".txt"
+	if meta, err := GetExperimentMeta(expId, requestRateLimit(r).owner()); err == nil && len(meta.Filename) > 0 {
+		filename = meta.Filename
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(source))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(source)))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(source)
+}
+
+//	experimentQCHandler reports replicate quality and the diagnostics of the run file:
+//
+//	/v2/experiments/{id}/qc    GET
+func experimentQCHandler(w http.ResponseWriter, r *http.Request) {
+	expId := r.PathValue("id")
+	e, ok := loadExperiment(w, r, expId)
+	if !ok {
+		return
+	}
+
+	report := QCReport{ExperimentId: expId, Status: "pass", Replicates: e.QualityControl(), Diagnostics: Diagnostics{}}
+
+	source, err := GetExperimentSource(expId)
+	if err != nil && err != redis.ErrNil {
+		slog.ErrorContext(r.Context(), "getting experiment source failed", "component", "experiments", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment source failed")
+		return
+	}
+	if instrument, found := findInstrument(e.Instrument); err == nil && found {
+		if computed, err := instrument.NewComputer(e.Calibrator).Compute(bytes.NewReader(source)); err == nil && computed.Diagnostics() != nil {
+			report.Diagnostics = computed.Diagnostics()
+		}
+	}
+
+	if len(report.Diagnostics) > 0 {
+		report.Status = "warn"
+	}
+	for _, replicate := range report.Replicates {
+		if len(replicate.Flags) > 0 {
+			report.Status = "warn"
+		}
+	}
+
+	writeExperimentJSON(w, r, report)
+}
+
+//	experimentTTL returns the remaining lifetime of the experiment, it responds with
+//	404 when the experiment does not exist
+func experimentTTL(w http.ResponseWriter, r *http.Request, expId string) (time.Duration, bool) {
+	ttl, err := GetExperimentTTL(expId)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "experiment not found", "component", "experiments", "experiment_id", expId)
+		writeProblem(w, r, http.StatusNotFound, "experiment_not_found", "experiment not found")
+		return 0, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment ttl failed", "component", "experiments", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment ttl failed")
+		return 0, false
+	}
+
+	return ttl, true
+}
+
+//	loadExperiment reads the stored experiment, it responds with 404 when the
+//	experiment does not exist
+func loadExperiment(w http.ResponseWriter, r *http.Request, expId string) (*Experiment, bool) {
+	expBytes, err := GetExperiment(expId)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "experiment not found", "component", "experiments", "experiment_id", expId)
+		writeProblem(w, r, http.StatusNotFound, "experiment_not_found", "experiment not found")
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting experiment failed", "component", "experiments", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiment failed")
+		return nil, false
+	}
+
+	var e Experiment
+	if err = json.Unmarshal(expBytes, &e); err != nil {
+		slog.ErrorContext(r.Context(), "parsing experiment failed", "component", "experiments", "experiment_id", expId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "parsing experiment failed")
+		return nil, false
+	}
+
+	return &e, true
+}
+
+func writeExperimentJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling response failed", "component", "experiments", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "marshalling response failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(content)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestDetectInstrument(t *testing.T) {
+	if instrument, found := detectInstrument([]byte(ab7300TestContent)); !found || instrument.Name != "ab7300" {
+		t.Errorf("ab7300 export should be detected, got '%s'", instrument.Name)
+	}
+
+	utf16le := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(ab7300TestContent)) {
+		utf16le = append(utf16le, byte(u), byte(u>>8))
+	}
+	if _, found := detectInstrument(utf16le); !found {
+		t.Error("UTF-16 ab7300 export should be detected")
+	}
+
+	if _, found := detectInstrument([]byte("Plate,Well\n1,A1\n")); found {
+		t.Error("Unknown export should not be detected")
+	}
+}
+
+func TestV2Routes(t *testing.T) {
+	rateLimiter = newMemoryRateLimiter()
+	redisPool = &redis.Pool{Dial: func() (redis.Conn, error) { return nil, errors.New("connection refused") }}
+	jobQueue = newJobQueue(newMemoryJobStore(), 0, 1, 0)
+	defer func() { rateLimiter, redisPool, jobQueue = nil, nil, nil }()
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, routes)
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"POST", "/v2/experiments", "Plate,Well\n1,A1\n", http.StatusBadRequest, "unknown_instrument"},
+		{"POST", "/v2/experiments?instrument=lc480&calibrator=mock", ab7300TestContent, http.StatusBadRequest, "unknown_instrument"},
+		{"POST", "/v2/experiments", ab7300TestContent, http.StatusBadRequest, "missing_calibrator"},
+		{"PUT", "/v2/experiments", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"POST", "/v2/experiments/abc/results", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"GET", "/v2/experiments/abc/qc", "", http.StatusInternalServerError, "internal_error"},
+		{"GET", "/v2/experiments/abc/unknown", "", http.StatusNotFound, ""},
+		{"GET", "/v2/jobs/abc", "", http.StatusNotFound, "job_not_found"},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(tc.method, tc.path, bytes.NewReader([]byte(tc.body)))
+		r.RemoteAddr = "192.0.2.1:4000"
+		mux.ServeHTTP(w, r)
+
+		if w.Code != tc.status || (len(tc.code) > 0 && !bytes.Contains(w.Body.Bytes(), []byte(`"code":"`+tc.code+`"`))) {
+			t.Errorf("%s %s should be %d %s, got %d %s", tc.method, tc.path, tc.status, tc.code, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestResourcePaths(t *testing.T) {
+	v1 := httptest.NewRequest("POST", "/v1/qpcr/ab7300", nil)
+	v2 := httptest.NewRequest("POST", "/v2/experiments", nil)
+
+	if path := experimentPath(v1, "abc"); path != "/v1/experiment/abc" {
+		t.Errorf("v1 experiment path should be relative to /v1, got %s", path)
+	}
+	if path := experimentPath(v2, "abc"); path != "/v2/experiments/abc" {
+		t.Errorf("v2 experiment path should be relative to /v2, got %s", path)
+	}
+	if path := jobPath(v2, "abc"); path != "/v2/jobs/abc" {
+		t.Errorf("v2 job path should be relative to /v2, got %s", path)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const tokenCommandUsage = `usage: qpcrbox token <command> [arguments]
+
+commands:
+    issue -owner <name> [-expires <duration>] [-requests-per-hour <n>] [-requests-burst <n>]
+          [-uploads-per-day <n>] [-max-upload-size <bytes>] [-max-experiments <n>]
+          [-callback-url <url>]
+    list
+    describe <token id>
+    rotate <token id>
+    revoke <token id>
+`
+
+//	tokenCommand manages consumer tokens directly in redis, it returns the process exit code
+func tokenCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, tokenCommandUsage)
+		return 2
+	}
+
+	var v interface{}
+	var err error
+
+	switch args[0] {
+	case "issue":
+		fs := flag.NewFlagSet("token issue", flag.ContinueOnError)
+		owner := fs.String("owner", "", "token owner name")
+		expires := fs.Duration("expires", 0, "token lifetime, 0 never expires")
+		callbackUrl := fs.String("callback-url", "", "url receiving signed results of all uploads of the token")
+		var limits TokenLimits
+		fs.IntVar(&limits.RequestsPerHour, "requests-per-hour", 0, "requests per hour, 0 uses the token tier default, -1 is unlimited")
+		fs.IntVar(&limits.RequestsBurst, "requests-burst", 0, "requests allowed at once, 0 uses the token tier default, -1 is unlimited")
+		fs.IntVar(&limits.UploadsPerDay, "uploads-per-day", 0, "uploads per day, 0 uses the token tier default, -1 is unlimited")
+		fs.Int64Var(&limits.MaxUploadSize, "max-upload-size", 0, "max upload size in bytes, 0 uses the token tier default, -1 is limited by the server only")
+		fs.IntVar(&limits.MaxExperiments, "max-experiments", 0, "max retained experiments, 0 uses the token tier default, -1 is unlimited")
+		if err = fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if _, err = parseTokenRequest(TokenRequest{Owner: *owner, ExpiresIn: expires.String(), CallbackUrl: *callbackUrl, Limits: limits}); err != nil {
+			fmt.Fprintf(os.Stderr, "token issue: %s\n", err)
+			return 2
+		}
+		v, err = IssueConsumerToken(*owner, *expires, limits, *callbackUrl)
+	case "list":
+		var tokenIds []string
+		tokens := []ConsumerToken{}
+		if tokenIds, err = GetConsumerTokenIds(); err == nil {
+			for _, tokenId := range tokenIds {
+				var ct ConsumerToken
+				if ct, _, err = GetConsumerTokenById(tokenId); err != nil {
+					break
+				}
+				tokens = append(tokens, ct)
+			}
+		}
+		v = tokens
+	case "describe", "rotate", "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, tokenCommandUsage)
+			return 2
+		}
+		v, err = tokenIdCommand(args[0], args[1])
+	default:
+		fmt.Fprint(os.Stderr, tokenCommandUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "token %s: %s\n", args[0], err)
+		return 1
+	}
+
+	out, _ := json.MarshalIndent(v, "", "    ")
+	fmt.Println(string(out))
+
+	return 0
+}
+
+func tokenIdCommand(command, tokenId string) (interface{}, error) {
+	switch command {
+	case "describe":
+		ct, _, err := GetConsumerTokenById(tokenId)
+		return ct, err
+	case "rotate":
+		return RotateConsumerToken(tokenId)
+	}
+
+	revoked, err := RevokeConsumerToken(tokenId)
+	if err == nil && !revoked {
+		err = fmt.Errorf("token '%s' not found", tokenId)
+	}
+
+	return map[string]interface{}{"TokenId": tokenId, "RevokedAt": time.Now().UTC()}, err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+)
+
+//	runTokenCommand returns the exit code and standard output of the token command
+func runTokenCommand(t *testing.T, args ...string) (int, []byte) {
+	stdout, stderr := os.Stdout, os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout, os.Stderr = w, devNull
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	code := tokenCommand(args)
+	w.Close()
+	devNull.Close()
+	out, _ := io.ReadAll(r)
+
+	return code, out
+}
+
+func TestTokenCommand(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	for _, args := range [][]string{{}, {"unknown"}, {"issue"}, {"issue", "-owner", "lab", "-uploads-per-day", "-5"}, {"issue", "-owner", "lab", "-expires", "soon"}, {"describe"}, {"rotate", "a", "b"}} {
+		if code, _ := runTokenCommand(t, args...); code != 2 {
+			t.Errorf("Token command %v should exit with usage error 2, got %d", args, code)
+		}
+	}
+
+	code, out := runTokenCommand(t, "issue", "-owner", "lab", "-requests-per-hour", "10")
+	var issued IssuedConsumerToken
+	if err := json.Unmarshal(out, &issued); code != 0 || err != nil || len(issued.Token) == 0 || issued.Limits.RequestsPerHour != 10 {
+		t.Fatalf("Token should be issued, got %d %s", code, out)
+	}
+
+	code, out = runTokenCommand(t, "list")
+	var tokens []ConsumerToken
+	if err := json.Unmarshal(out, &tokens); code != 0 || err != nil || len(tokens) != 1 || tokens[0].TokenId != issued.TokenId {
+		t.Errorf("Issued token should be listed, got %d %s", code, out)
+	}
+
+	code, out = runTokenCommand(t, "rotate", issued.TokenId)
+	var rotated IssuedConsumerToken
+	if err := json.Unmarshal(out, &rotated); code != 0 || err != nil || rotated.Token == issued.Token {
+		t.Errorf("Token should be rotated, got %d %s", code, out)
+	}
+
+	if code, _ = runTokenCommand(t, "revoke", issued.TokenId); code != 0 {
+		t.Errorf("Token should be revoked, got %d", code)
+	}
+	for _, command := range []string{"describe", "rotate", "revoke"} {
+		if code, _ = runTokenCommand(t, command, issued.TokenId); code != 1 {
+			t.Errorf("%s of a revoked token should exit with 1, got %d", command, code)
+		}
+	}
+}
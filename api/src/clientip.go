@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	//	trustedProxies are the peers allowed to set the client ip address header
+	trustedProxies []*net.IPNet
+	//	clientIPHeader is the only header read from trusted proxies, the proxy has to
+	//	overwrite it, otherwise clients can choose their address
+	clientIPHeader = "X-Real-Ip"
+
+	clientIPHeaders = []string{"X-Real-Ip", "X-Forwarded-For", "Forwarded"}
+)
+
+//	parseClientIPHeader returns the canonical name of one of the client ip headers
+func parseClientIPHeader(value string) (string, error) {
+	for _, header := range clientIPHeaders {
+		if strings.EqualFold(strings.TrimSpace(value), header) {
+			return header, nil
+		}
+	}
+
+	return "", fmt.Errorf("client ip header '%s' is not one of %s", value, strings.Join(clientIPHeaders, ", "))
+}
+
+//	parseTrustedProxies parses a comma separated list of CIDRs, plain addresses are
+//	taken as single host networks
+func parseTrustedProxies(value string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, cidr := range strings.Split(value, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy '%s' is not valid", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy '%s' is not valid", cidr)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//	clientIPAddress resolves the client ip address. The clientIPHeader is only used
+//	when the peer is a trusted proxy; proxy chains are walked from the nearest hop and
+//	the first address which is not a trusted proxy wins.
+func clientIPAddress(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !isTrustedProxy(peerIP) {
+		return peer
+	}
+
+	switch clientIPHeader {
+	case "Forwarded":
+		if hops := forwardedFor(r.Header.Values("Forwarded")); len(hops) > 0 {
+			return untrustedHop(hops)
+		}
+	case "X-Forwarded-For":
+		if hops := splitHeaderList(r.Header.Values("X-Forwarded-For")); len(hops) > 0 {
+			return untrustedHop(hops)
+		}
+	default:
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); realIP != nil {
+			return realIP.String()
+		}
+	}
+
+	return peer
+}
+
+//	untrustedHop returns the rightmost hop which is not a trusted proxy, or the
+//	leftmost one when the whole chain is trusted
+func untrustedHop(hops []string) string {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			//	unknown or obfuscated identifiers can not be trusted further
+			return hops[i]
+		}
+		if !isTrustedProxy(ip) || i == 0 {
+			return ip.String()
+		}
+	}
+
+	return hops[0]
+}
+
+//	forwardedFor returns the for= parameters of RFC 7239 Forwarded headers
+func forwardedFor(values []string) []string {
+	hops := []string{}
+	for _, element := range splitHeaderList(values) {
+		for _, pair := range strings.Split(element, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || !strings.EqualFold(name, "for") {
+				continue
+			}
+
+			value = strings.Trim(value, `"`)
+			if strings.HasPrefix(value, "[") {
+				//	[2001:db8::1]:4711
+				value = strings.TrimPrefix(value, "[")
+				value, _, _ = strings.Cut(value, "]")
+			} else if host, _, err := net.SplitHostPort(value); err == nil {
+				value = host
+			}
+			hops = append(hops, value)
+		}
+	}
+
+	return hops
+}
+
+func splitHeaderList(values []string) []string {
+	items := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return items
+}
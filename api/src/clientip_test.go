@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIPAddress(t *testing.T) {
+	var err error
+	if trustedProxies, err = parseTrustedProxies("127.0.0.1, 10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	defer func() { clientIPHeader = "X-Real-Ip" }()
+
+	tests := []struct {
+		clientIPHeader, remoteAddr string
+		header                     http.Header
+		ip                         string
+	}{
+		{"X-Real-Ip", "192.0.2.1:4000", http.Header{"X-Real-Ip": {"198.51.100.7"}}, "192.0.2.1"},
+		{"X-Real-Ip", "127.0.0.1:4000", http.Header{"X-Real-Ip": {"198.51.100.7"}}, "198.51.100.7"},
+		{"X-Real-Ip", "127.0.0.1:4000", http.Header{"X-Real-Ip": {"198.51.100.7"}, "X-Forwarded-For": {"203.0.113.9"}, "Forwarded": {"for=203.0.113.9"}}, "198.51.100.7"},
+		{"X-Real-Ip", "127.0.0.1:4000", http.Header{"X-Forwarded-For": {"203.0.113.9"}}, "127.0.0.1"},
+		{"X-Forwarded-For", "127.0.0.1:4000", http.Header{"X-Forwarded-For": {"203.0.113.9, 198.51.100.7, 10.0.0.2"}}, "198.51.100.7"},
+		{"X-Forwarded-For", "127.0.0.1:4000", http.Header{"X-Real-Ip": {"203.0.113.9"}, "Forwarded": {"for=203.0.113.9"}}, "127.0.0.1"},
+		{"Forwarded", "127.0.0.1:4000", http.Header{"Forwarded": {`for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`}}, "2001:db8::1"},
+		{"Forwarded", "127.0.0.1:4000", http.Header{"X-Forwarded-For": {"203.0.113.9"}}, "127.0.0.1"},
+		{"X-Real-Ip", "127.0.0.1:4000", http.Header{}, "127.0.0.1"},
+	}
+
+	for _, test := range tests {
+		clientIPHeader = test.clientIPHeader
+		r := &http.Request{RemoteAddr: test.remoteAddr, Header: test.header}
+		if ip := clientIPAddress(r); ip != test.ip {
+			t.Errorf("Client ip of %s %v from %s should be '%s', got '%s'!", test.remoteAddr, test.header, test.clientIPHeader, test.ip, ip)
+		}
+	}
+}
+
+func TestParseClientIPHeader(t *testing.T) {
+	for value, expected := range map[string]string{"x-real-ip": "X-Real-Ip", "X-Forwarded-For": "X-Forwarded-For", " forwarded ": "Forwarded"} {
+		if header, err := parseClientIPHeader(value); err != nil || header != expected {
+			t.Errorf("Client ip header '%s' should be '%s', got '%s' %v!", value, expected, header, err)
+		}
+	}
+
+	if _, err := parseClientIPHeader("X-Client-Ip"); err == nil {
+		t.Error("Unknown client ip header should not be valid!")
+	}
+}
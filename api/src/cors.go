@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//	CORSConfig configures cross origin requests of all routes, allowed methods come
+//	from the route itself
+type CORSConfig struct {
+	//	AllowedOrigins lists origins like https://www.qpcrbox.com, "*" allows any origin
+	AllowedOrigins                 []string
+	AllowedHeaders, ExposedHeaders []string
+	MaxAge                         time.Duration
+}
+
+var corsConfig = CORSConfig{
+	AllowedOrigins: []string{"*"},
+	AllowedHeaders: []string{"Accept", "Authorization", "Callback-Url", "Consumer-Token", "Content-Disposition", "Content-Encoding", "Content-Type", "If-None-Match", "Prefer", "X-Request-Id"},
+	ExposedHeaders: []string{"Content-Disposition", "Content-Location", "ETag", "Location", "Preference-Applied", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-Id"},
+	MaxAge:         10 * time.Minute,
+}
+
+//	parseOrigins parses the comma separated origin allowlist
+func parseOrigins(value string) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); len(origin) > 0 {
+			origins = append(origins, origin)
+		}
+	}
+
+	return origins
+}
+
+//	allowOrigin returns the Access-Control-Allow-Origin value for the origin, empty
+//	when the origin is not allowed
+func (cc *CORSConfig) allowOrigin(origin string) string {
+	for _, allowed := range cc.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+//	withCORS sets CORS headers for allowed origins and answers OPTIONS requests, both
+//	preflight and plain ones, with the methods of the route. Responses vary by Origin
+//	unless any origin is allowed, so shared caches do not serve them across origins.
+func withCORS(methods []string) Middleware {
+	allowMethods := strings.Join(methods, ", ") + ", OPTIONS"
+	allowHeaders := strings.Join(corsConfig.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(corsConfig.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(corsConfig.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowOrigin := corsConfig.allowOrigin(r.Header.Get("Origin"))
+			if allowOrigin != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			if len(allowOrigin) > 0 {
+				w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+				w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+
+			if r.Method != "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(allowOrigin) > 0 && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+				w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.Header().Set("Allow", allowMethods)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	defaultOrigins := corsConfig.AllowedOrigins
+	corsConfig.AllowedOrigins = parseOrigins("https://www.qpcrbox.com/, http://localhost:8000")
+	defer func() { corsConfig.AllowedOrigins = defaultOrigins }()
+
+	h := withCORS([]string{"GET", "DELETE"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("OPTIONS", "/v1/experiment/1", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "DELETE")
+		r.Header.Set("Access-Control-Request-Headers", "consumer-token")
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("https://www.qpcrbox.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://www.qpcrbox.com" {
+		t.Errorf("Preflight of allowed origin failed with %d %+v!", w.Code, w.Header())
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != "GET, DELETE, OPTIONS" || w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Preflight headers %+v are not valid!", w.Header())
+	}
+
+	if w = preflight("https://evil.example.com"); len(w.Header().Get("Access-Control-Allow-Origin")) > 0 || len(w.Header().Get("Access-Control-Allow-Methods")) > 0 {
+		t.Errorf("Origin which is not allowed got CORS headers %+v!", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v1/experiment/1", nil))
+	if w.Header().Get("Vary") != "Origin" || len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("Response without Origin should vary by Origin, got %+v!", w.Header())
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	h := withCORS([]string{"GET"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, origin := range []string{"", "https://www.qpcrbox.com"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/v1/experiment/1", nil)
+		if len(origin) > 0 {
+			r.Header.Set("Origin", origin)
+		}
+		h.ServeHTTP(w, r)
+		if w.Header().Get("Access-Control-Allow-Origin") != "*" || len(w.Header().Get("Vary")) > 0 {
+			t.Errorf("Response to origin '%s' should allow any origin without varying, got %+v!", origin, w.Header())
+		}
+	}
+}
@@ -2,12 +2,225 @@ package main
 
 import (
 	"log"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
 	"archive/zip"
 )
 
+//	Exporter exports a single experiment, exporters register their format in init
 type Exporter interface {
-	Export(e *Experiment) ([]byte, error)
-	ContentType() string
+	Export(e *Experiment, options ExportOptions) ([]byte, error)
+}
+
+//	ProjectExporter exports all experiments of a project into one document
+type ProjectExporter interface {
+	ExportProject(experiments []ProjectExperiment, options ExportOptions) ([]byte, error)
+}
+
+//	ExportOptions tune the exported values. Precision is the number of decimals, -1
+//	keeps the shortest exact representation. Locale sets the decimal separator of
+//	text values and RawValues adds the Ct values as exported by the instrument.
+type ExportOptions struct {
+	Precision int
+	Locale    string
+	RawValues bool
+}
+
+//	ExportFormat registers an exporter under its media type and file extension,
+//	Attachment formats are downloaded as files and Defaults are the options used
+//	when the request does not set them
+type ExportFormat struct {
+	Extension, ContentType, Description string
+	Attachment                          bool
+	Defaults                            ExportOptions
+	Exporter                            Exporter
+	//	Version is bumped whenever the exporter output changes, it is part of the ETag
+	//	so cached downloads are not revalidated with stale content
+	Version int
+}
+
+const (
+	//	defaultExportFormat is served when the request does not prefer another format,
+	//	defaultProjectExportFormat for projects
+	defaultExportFormat        = "json"
+	defaultProjectExportFormat = "csv"
+	exportMaxPrecision  = 15
+)
+
+var (
+	//	documentExportDefaults keep all values of structured documents
+	documentExportDefaults = ExportOptions{Precision: -1, Locale: "en", RawValues: true}
+	//	tableExportDefaults round values of spreadsheets and leave out raw values
+	tableExportDefaults = ExportOptions{Precision: 6, Locale: "en", RawValues: false}
+
+	//	exportFormats are the registered formats in registration order
+	exportFormats              = []*ExportFormat{}
+	exportFormatsByContentType = make(map[string]*ExportFormat)
+	exportFormatsByExtension   = make(map[string]*ExportFormat)
+
+	//	decimalCommaLanguages write decimals with a comma, CSV exports in these
+	//	languages are separated by semicolons
+	decimalCommaLanguages = map[string]bool{
+		"bg": true, "cs": true, "da": true, "de": true, "el": true, "es": true, "fi": true, "fr": true,
+		"hr": true, "hu": true, "id": true, "it": true, "nb": true, "nl": true, "no": true, "pl": true,
+		"pt": true, "ro": true, "ru": true, "sk": true, "sl": true, "sv": true, "tr": true, "uk": true,
+	}
+)
+
+//	registerExportFormat adds the format to the registry, registering a media type
+//	or extension twice is a programming error and panics
+func registerExportFormat(format ExportFormat) {
+	if _, found := exportFormatsByContentType[format.ContentType]; found {
+		panic("export format " + format.ContentType + " is already registered")
+	}
+	if _, found := exportFormatsByExtension[format.Extension]; found {
+		panic("export format extension " + format.Extension + " is already registered")
+	}
+
+	exportFormats = append(exportFormats, &format)
+	exportFormatsByContentType[format.ContentType] = &format
+	exportFormatsByExtension[format.Extension] = &format
+}
+
+func findExportFormat(extension string) (ExportFormat, bool) {
+	if format, found := exportFormatsByExtension[extension]; found {
+		return *format, true
+	}
+
+	return ExportFormat{}, false
+}
+
+func findExportFormatByContentType(contentType string) (ExportFormat, bool) {
+	if format, found := exportFormatsByContentType[contentType]; found {
+		return *format, true
+	}
+
+	return ExportFormat{}, false
+}
+
+//	ProjectExport reports whether the format also exports projects
+func (format ExportFormat) ProjectExport() bool {
+	_, ok := format.Exporter.(ProjectExporter)
+
+	return ok
+}
+
+//	exportContentTypes returns media types of the formats with the default format
+//	first, project limits them to formats exporting projects
+func exportContentTypes(project bool) []string {
+	defaultFormat := defaultExportFormat
+	if project {
+		defaultFormat = defaultProjectExportFormat
+	}
+
+	contentTypes := []string{}
+	for _, format := range exportFormats {
+		if project && !format.ProjectExport() {
+			continue
+		}
+		if format.Extension == defaultFormat {
+			contentTypes = append([]string{format.ContentType}, contentTypes...)
+		} else {
+			contentTypes = append(contentTypes, format.ContentType)
+		}
+	}
+
+	return contentTypes
+}
+
+//	exportFormatNames returns the extensions of the content types
+func exportFormatNames(contentTypes []string) []string {
+	names := []string{}
+	for _, contentType := range contentTypes {
+		if format, found := findExportFormatByContentType(contentType); found {
+			names = append(names, format.Extension)
+		}
+	}
+
+	return names
+}
+
+//	attachmentDisposition returns the Content-Disposition of a download named after the
+//	base name, path separators of the name are replaced
+func attachmentDisposition(name string, format ExportFormat) string {
+	name = strings.NewReplacer("/", "-", "\\", "-").Replace(name)
+
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format.Extension})
+}
+
+//	decimalComma reports whether the locale writes decimals with a comma
+func (o ExportOptions) decimalComma() bool {
+	language, _, _ := strings.Cut(strings.ReplaceAll(o.Locale, "_", "-"), "-")
+
+	return decimalCommaLanguages[strings.ToLower(language)]
+}
+
+//	formatValue formats the value for machine readable fields, which always use a point
+func (o ExportOptions) formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', o.Precision, 64)
+}
+
+//	formatText formats the value for display with the decimal separator of the locale
+func (o ExportOptions) formatText(v float64) string {
+	if o.decimalComma() {
+		return strings.Replace(o.formatValue(v), ".", ",", 1)
+	}
+
+	return o.formatValue(v)
+}
+
+func (o ExportOptions) round(v float64) float64 {
+	if o.Precision < 0 {
+		return v
+	}
+	scale := math.Pow(10, float64(o.Precision))
+
+	return math.Round(v*scale) / scale
+}
+
+//	exportedExperiment applies precision and raw values options to a copy of the
+//	experiment for the document formats
+func exportedExperiment(e *Experiment, o ExportOptions) *Experiment {
+	exported := &Experiment{Instrument: e.Instrument, Calibrator: e.Calibrator, Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+
+	for detectorName, detector := range e.Detectors {
+		exported.Detectors[detectorName] = make(DetectorTargetGeneMap)
+		for targetGeneName, tg := range detector {
+			if !o.RawValues {
+				tg.RawValues = nil
+			}
+			tg.Values = o.roundValues(tg.Values)
+			tg.Mean, tg.StdDev, tg.DCt, tg.DdCt = o.round(tg.Mean), o.round(tg.StdDev), o.round(tg.DCt), o.round(tg.DdCt)
+			tg.DdCtErr, tg.RQ, tg.RQErr = o.round(tg.DdCtErr), o.round(tg.RQ), o.round(tg.RQErr)
+			exported.Detectors[detectorName][targetGeneName] = tg
+		}
+	}
+
+	for name, endoTargetGene := range e.EndogenousControls {
+		if !o.RawValues {
+			endoTargetGene.Detectors = make(StringArrayMap)
+		}
+		endoTargetGene.Values = o.roundValues(endoTargetGene.Values)
+		endoTargetGene.Mean, endoTargetGene.StdDev = o.round(endoTargetGene.Mean), o.round(endoTargetGene.StdDev)
+		exported.EndogenousControls[name] = endoTargetGene
+	}
+
+	return exported
+}
+
+func (o ExportOptions) roundValues(values []float64) []float64 {
+	if values == nil || o.Precision < 0 {
+		return values
+	}
+
+	rounded := make([]float64, len(values))
+	for i, v := range values {
+		rounded[i] = o.round(v)
+	}
+
+	return rounded
 }
 
 type FileData struct {
@@ -1,30 +1,15 @@
 package main
 
-import (
-	"fmt"
-	"bytes"
-)
-
 type CSVExport struct {}
 
-func (export *CSVExport) Export(e *Experiment) ([]byte, error) {
-	var content bytes.Buffer
-
-	content.WriteString("name,mean,stddev\n")
-	for endogenousControlName, endogenousControl := range e.EndogenousControls {
-		content.WriteString(fmt.Sprintf("%s,%f,%f\n", endogenousControlName, endogenousControl.Mean, endogenousControl.StdDev))
-	}
-
-	content.WriteString("\ndetector,name,mean,stddev,dct,ddct,ddcterr,rq,rqerr\n")
-	for detectorName, detector := range e.Detectors {
-		for targetGeneName, targetGene := range detector {
-			content.WriteString(fmt.Sprintf("%s,%s,%f,%f,%f,%f,%f,%f,%f\n", detectorName, targetGeneName, targetGene.Mean, targetGene.StdDev, targetGene.DCt, targetGene.DdCt, targetGene.DdCtErr, targetGene.RQ, targetGene.RQErr))
-		}
-	}
+func init() {
+	registerExportFormat(ExportFormat{Extension: "csv", ContentType: "text/csv", Description: "comma separated values, semicolons for locales with a decimal comma", Attachment: true, Defaults: tableExportDefaults, Exporter: &CSVExport{}})
+}
 
-	return content.Bytes(), nil
+func (export *CSVExport) Export(e *Experiment, options ExportOptions) ([]byte, error) {
+	return csvTable(experimentTable(e, options), options)
 }
 
-func (export *CSVExport) ContentType() string {
-	return "text/csv"
+func (export *CSVExport) ExportProject(experiments []ProjectExperiment, options ExportOptions) ([]byte, error) {
+	return csvTable(projectTable(experiments, options), options)
 }
@@ -1,22 +1,22 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"encoding/json"
 )
 
 type JSONExport struct {}
 
-func (export *JSONExport) Export(e *Experiment) ([]byte, error) {
-	content, err := json.Marshal(e)
+func init() {
+	registerExportFormat(ExportFormat{Extension: "json", ContentType: "application/json", Description: "experiment document", Defaults: documentExportDefaults, Exporter: &JSONExport{}})
+}
+
+func (export *JSONExport) Export(e *Experiment, options ExportOptions) ([]byte, error) {
+	content, err := json.Marshal(exportedExperiment(e, options))
 	if err != nil {
-		log.Printf("[export|json] experiment marshalling failed! Error: '%s'\n", err)
+		slog.Error("experiment marshalling failed", "component", "export|json", "error", err)
 		return []byte{}, err
 	}
 
 	return content, nil
 }
-
-func (export *JSONExport) ContentType() string {
-	return "application/json"
-}
@@ -4,17 +4,30 @@ import (
 	"bytes"
 	"archive/zip"
 	"fmt"
+	"encoding/xml"
 )
 
 type ODSExport struct {}
 
-func (export *ODSExport) Export(e *Experiment) ([]byte, error) {
+func init() {
+	registerExportFormat(ExportFormat{Extension: "ods", ContentType: "application/vnd.oasis.opendocument.spreadsheet", Description: "OpenDocument spreadsheet", Attachment: true, Defaults: tableExportDefaults, Exporter: &ODSExport{}})
+}
+
+func (export *ODSExport) Export(e *Experiment, options ExportOptions) ([]byte, error) {
+	return odsArchive(odsTableContentXmlFileContent(experimentTable(e, options), options)), nil
+}
+
+func (export *ODSExport) ExportProject(experiments []ProjectExperiment, options ExportOptions) ([]byte, error) {
+	return odsArchive(odsTableContentXmlFileContent(projectTable(experiments, options), options)), nil
+}
+
+func odsArchive(contentXml string) []byte {
 	content := new(bytes.Buffer)
 	zw := zip.NewWriter(content)
 
 	files := []FileData{
 		FileData{"META-INF/manifest.xml", odsMetaInfManifestXmlFileContent()},
-		FileData{"content.xml", odsContentXmlFileContent(e)},
+		FileData{"content.xml", contentXml},
 		FileData{"meta.xml", odsMetaXmlFileContent()},
 		FileData{"mimetype", odsMimetypeFileContent()},
 		FileData{"settings.xml", odsSettingsXmlFileContent()},
@@ -27,11 +40,7 @@ func (export *ODSExport) Export(e *Experiment) ([]byte, error) {
 
 	zw.Close()
 
-	return content.Bytes(), nil
-}
-
-func (export *ODSExport) ContentType() string {
-	return "application/vnd.oasis.opendocument.spreadsheet"
+	return content.Bytes()
 }
 
 func odsMetaInfManifestXmlFileContent() string {
@@ -45,10 +54,8 @@ func odsMetaInfManifestXmlFileContent() string {
 </manifest:manifest>`
 }
 
-func odsContentXmlFileContent(e *Experiment) string {
-	content := new(bytes.Buffer)
-
-	header := `<?xml version="1.0" encoding="UTF-8"?>
+func odsContentXmlHeader() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
 	<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0" xmlns:svg="urn:oasis:names:tc:opendocument:xmlns:svg-compatible:1.0" office:version="1.2">
 		<office:scripts/>
 		<office:font-face-decls>
@@ -75,113 +82,39 @@ func odsContentXmlFileContent(e *Experiment) string {
 		<office:body>
 			<office:spreadsheet>
 				<table:table table:name="Results" table:style-name="ta1">`
-	content.WriteString(header)
-
-	endogenousControlHeader := `<table:table-row table:style-name="ro1">
-                    <table:table-cell office:value-type="string">
-                        <text:p>name</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>mean</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>stddev</text:p>
-                    </table:table-cell>
-                    <table:table-cell table:number-columns-repeated="6"/>
-                </table:table-row>`
-	content.WriteString(endogenousControlHeader)
-
-	for endogenousControlName, endogenousControl := range e.EndogenousControls {
-		endogenousControlRow := `<table:table-row table:style-name="ro1">
-                    <table:table-cell office:value-type="string">
-                        <text:p>%s</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell table:number-columns-repeated="6"/>
-                </table:table-row>`
-		content.WriteString(fmt.Sprintf(endogenousControlRow, endogenousControlName, endogenousControl.Mean, endogenousControl.Mean, endogenousControl.StdDev, endogenousControl.StdDev))
-	}
-
-	targetGeneHeader := `<table:table-row table:style-name="ro1">
-                    <table:table-cell table:number-columns-repeated="9"/>
-                </table:table-row>
-                <table:table-row table:style-name="ro1">
-                    <table:table-cell office:value-type="string">
-                        <text:p>detector</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>name</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>mean</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>stddev</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>dct</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>ddct</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>ddcterr</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>rq</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>rqerr</text:p>
-                    </table:table-cell>
-                </table:table-row>`
-	content.WriteString(targetGeneHeader)
-
-	for detectorName, detector := range e.Detectors {
-		for targetGeneName, targetGene := range detector {
-			targetGeneRow := `<table:table-row table:style-name="ro1">
-                    <table:table-cell office:value-type="string">
-                        <text:p>%s</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="string">
-                        <text:p>%s</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                    <table:table-cell office:value-type="float" office:value="%f">
-                        <text:p>%f</text:p>
-                    </table:table-cell>
-                </table:table-row>`
-			content.WriteString(fmt.Sprintf(targetGeneRow, detectorName, targetGeneName, targetGene.Mean, targetGene.Mean, targetGene.StdDev, targetGene.StdDev, targetGene.DCt, targetGene.DCt, targetGene.DdCt, targetGene.DdCt, targetGene.DdCtErr, targetGene.DdCtErr, targetGene.RQ, targetGene.RQ, targetGene.RQErr, targetGene.RQErr))
-		}
-	}
+}
 
-	footer := `</table:table>
+func odsContentXmlFooter() string {
+	return `</table:table>
       <table:named-expressions/>
     </office:spreadsheet>
   </office:body>
 </office:document-content>`
-	content.WriteString(footer)
+}
+
+//	odsTableContentXmlFileContent returns content.xml with the table as the Results sheet,
+//	cells store the value and show it with the decimal separator of the locale
+func odsTableContentXmlFileContent(t Table, options ExportOptions) string {
+	content := new(bytes.Buffer)
+
+	content.WriteString(odsContentXmlHeader())
+	for _, row := range t {
+		content.WriteString(`<table:table-row table:style-name="ro1">`)
+		for _, cell := range row {
+			switch v := cell.(type) {
+			case string:
+				content.WriteString(`<table:table-cell office:value-type="string"><text:p>`)
+				xml.EscapeText(content, []byte(v))
+				content.WriteString(`</text:p></table:table-cell>`)
+			case float64:
+				content.WriteString(fmt.Sprintf(`<table:table-cell office:value-type="float" office:value="%s"><text:p>%s</text:p></table:table-cell>`, options.formatValue(v), options.formatText(v)))
+			default:
+				content.WriteString(`<table:table-cell/>`)
+			}
+		}
+		content.WriteString(`</table:table-row>`)
+	}
+	content.WriteString(odsContentXmlFooter())
 
 	return content.String()
 }
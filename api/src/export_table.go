@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+)
+
+//	Table is a sheet of rows used by the spreadsheet exports, cells are string or
+//	float64 values, nil cells are left empty
+type Table [][]interface{}
+
+type ProjectExperiment struct {
+	ExperimentId string
+	Experiment   *Experiment
+}
+
+//	experimentTable lays out the experiment as endogenous controls followed by target
+//	genes, a raw column lists the Ct values when options ask for raw values
+func experimentTable(e *Experiment, options ExportOptions) Table {
+	return projectTable([]ProjectExperiment{{Experiment: e}}, options)
+}
+
+//	projectTable concatenates the tables of all experiments with a leading experiment
+//	column, the column is left out for a single experiment without id
+func projectTable(experiments []ProjectExperiment, options ExportOptions) Table {
+	withExperiment := len(experiments) != 1 || len(experiments[0].ExperimentId) > 0
+	row := func(pe ProjectExperiment, cells ...interface{}) []interface{} {
+		if withExperiment {
+			return append([]interface{}{pe.ExperimentId}, cells...)
+		}
+		return cells
+	}
+	header := func(cells ...interface{}) []interface{} {
+		if options.RawValues {
+			cells = append(cells, "raw")
+		}
+		return row(ProjectExperiment{ExperimentId: "experiment"}, cells...)
+	}
+
+	t := Table{header("name", "mean", "stddev")}
+	for _, pe := range experiments {
+		for _, endogenousControlName := range pe.Experiment.EndogenousControls.Names() {
+			endogenousControl := pe.Experiment.EndogenousControls[endogenousControlName]
+			cells := []interface{}{endogenousControlName, endogenousControl.Mean, endogenousControl.StdDev}
+			if options.RawValues {
+				rawValues := []string{}
+				for _, detectorName := range endogenousControl.Detectors.Names() {
+					rawValues = append(rawValues, endogenousControl.Detectors[detectorName]...)
+				}
+				cells = append(cells, strings.Join(rawValues, " "))
+			}
+			t = append(t, row(pe, cells...))
+		}
+	}
+
+	t = append(t, []interface{}{})
+	t = append(t, header("detector", "name", "mean", "stddev", "dct", "ddct", "ddcterr", "rq", "rqerr"))
+	for _, pe := range experiments {
+		for _, detectorName := range pe.Experiment.Detectors.Names() {
+			detector := pe.Experiment.Detectors[detectorName]
+			for _, targetGeneName := range detector.Names() {
+				tg := detector[targetGeneName]
+				cells := []interface{}{detectorName, targetGeneName, tg.Mean, tg.StdDev, tg.DCt, tg.DdCt, tg.DdCtErr, tg.RQ, tg.RQErr}
+				if options.RawValues {
+					cells = append(cells, strings.Join(tg.RawValues, " "))
+				}
+				t = append(t, row(pe, cells...))
+			}
+		}
+	}
+
+	return t
+}
+
+//	csvTable writes the table, locales with a decimal comma are separated by semicolons
+func csvTable(t Table, options ExportOptions) ([]byte, error) {
+	var content bytes.Buffer
+	cw := csv.NewWriter(&content)
+	if options.decimalComma() {
+		cw.Comma = ';'
+	}
+
+	for _, row := range t {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			switch v := cell.(type) {
+			case string:
+				record[i] = v
+			case float64:
+				record[i] = options.formatText(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return []byte{}, err
+		}
+	}
+	cw.Flush()
+
+	return content.Bytes(), cw.Error()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProjectTableExperimentColumn(t *testing.T) {
+	e := &Experiment{Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	e.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+	e.addEndogenousControlTargetGeneValue("Mock", "18S", "12.0")
+
+	content, err := (&CSVExport{}).ExportProject([]ProjectExperiment{{"a", e}, {"b", e}}, tableExportDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csv := string(content)
+	if !strings.Contains(csv, "a,GAPDH,Mock,") || !strings.Contains(csv, "b,GAPDH,Mock,") {
+		t.Errorf("Project CSV does not contain rows of both experiments:\n%s", csv)
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	for index, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if xlsxColumnName(index) != name {
+			t.Errorf("Column %d should be '%s', got '%s'!", index, name, xlsxColumnName(index))
+		}
+	}
+}
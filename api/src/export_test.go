@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseExportOptions(t *testing.T) {
+	for query, expected := range map[string]ExportOptions{
+		"":                         tableExportDefaults,
+		"precision=2":              {2, "en", false},
+		"locale=de-AT&precision=0": {0, "de-AT", false},
+		"raw-values=true":          {6, "en", true},
+	} {
+		values, _ := url.ParseQuery(query)
+		options, err := parseExportOptions(values, tableExportDefaults)
+		if err != nil || options != expected {
+			t.Errorf("Query '%s' should parse to %+v, got %+v %v", query, expected, options, err)
+		}
+	}
+
+	for _, query := range []string{"precision=-1", "precision=16", "precision=two", "locale=de@AT", "raw-values=maybe"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseExportOptions(values, tableExportDefaults); err == nil {
+			t.Errorf("Query '%s' should not be valid", query)
+		}
+	}
+}
+
+func TestExportOptions(t *testing.T) {
+	e := &Experiment{Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	e.Detectors["GAPDH"] = DetectorTargetGeneMap{"Mock": {RawValues: []string{"21.5", "21.75"}, Values: []float64{21.5, 21.75}, Mean: 21.6251}}
+
+	content, err := (&CSVExport{}).Export(e, ExportOptions{Precision: 2, Locale: "de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := string(content)
+	if !strings.Contains(csv, ";21,63;") || strings.Contains(csv, "21.63") {
+		t.Errorf("German CSV should be separated by semicolons with decimal commas:\n%s", csv)
+	}
+
+	content, err = (&CSVExport{}).Export(e, ExportOptions{Precision: 2, Locale: "en", RawValues: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "21.75") {
+		t.Errorf("CSV with raw values should contain the instrument values:\n%s", content)
+	}
+
+	exported := exportedExperiment(e, ExportOptions{Precision: 1})
+	if tg := exported.Detectors["GAPDH"]["Mock"]; tg.Mean != 21.6 || tg.RawValues != nil {
+		t.Errorf("Exported target gene should be rounded without raw values, got %+v", tg)
+	}
+	if e.Detectors["GAPDH"]["Mock"].Mean != 21.6251 {
+		t.Errorf("Exporting should not change the experiment, got %+v", e.Detectors["GAPDH"]["Mock"])
+	}
+}
+
+func TestRegisterExportFormatTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering json twice should panic")
+		}
+	}()
+
+	registerExportFormat(ExportFormat{Extension: "json", ContentType: "application/json", Exporter: &JSONExport{}})
+}
+
+func TestFormatsHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	formatsHandler(w, httptest.NewRequest("GET", "/v1/formats", nil))
+
+	var response FormatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Default != "json" || len(response.Formats) != len(exportFormats) || response.Formats[0].Extension != "json" {
+		t.Errorf("Formats should list all formats with json first, got %+v", response)
+	}
+	for _, format := range response.Formats {
+		if format.Extension == "csv" && (!format.ProjectExport || format.Defaults != tableExportDefaults) {
+			t.Errorf("CSV should export projects with table defaults, got %+v", format)
+		}
+	}
+}
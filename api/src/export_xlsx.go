@@ -1,16 +1,116 @@
 package main
 
-import "bytes"
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
 
-type XLSXExport struct {}
+type XLSXExport struct{}
 
-func (export *XLSXExport) Export(e *Experiment) ([]byte, error) {
+func init() {
+	registerExportFormat(ExportFormat{Extension: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Description: "Excel workbook", Attachment: true, Defaults: tableExportDefaults, Exporter: &XLSXExport{}})
+}
+
+func (export *XLSXExport) Export(e *Experiment, options ExportOptions) ([]byte, error) {
+	return xlsxArchive(experimentTable(e, options), options), nil
+}
+
+func (export *XLSXExport) ExportProject(experiments []ProjectExperiment, options ExportOptions) ([]byte, error) {
+	return xlsxArchive(projectTable(experiments, options), options), nil
+}
+
+//	xlsxArchive writes the workbook, cells store numbers so the locale of the
+//	spreadsheet application formats them
+func xlsxArchive(t Table, options ExportOptions) []byte {
 	content := new(bytes.Buffer)
+	zw := zip.NewWriter(content)
+
+	files := []FileData{
+		FileData{"[Content_Types].xml", xlsxContentTypesXmlFileContent()},
+		FileData{"_rels/.rels", xlsxRelsFileContent()},
+		FileData{"xl/workbook.xml", xlsxWorkbookXmlFileContent()},
+		FileData{"xl/_rels/workbook.xml.rels", xlsxWorkbookRelsFileContent()},
+		FileData{"xl/worksheets/sheet1.xml", xlsxSheetXmlFileContent(t, options)},
+	}
+
+	for _, fd := range files {
+		addToArchive(zw, fd)
+	}
+
+	zw.Close()
+
+	return content.Bytes()
+}
 
-	return content.Bytes(), nil
+func xlsxContentTypesXmlFileContent() string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+    <Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+    <Default Extension="xml" ContentType="application/xml"/>
+    <Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+    <Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
 }
 
-func (export *XLSXExport) ContentType() string {
-	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+func xlsxRelsFileContent() string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+    <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
 }
 
+func xlsxWorkbookXmlFileContent() string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+    <sheets>
+        <sheet name="Results" sheetId="1" r:id="rId1"/>
+    </sheets>
+</workbook>`
+}
+
+func xlsxWorkbookRelsFileContent() string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+    <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+}
+
+//	xlsxSheetXmlFileContent writes the table using inline strings, so no shared
+//	strings part is needed
+func xlsxSheetXmlFileContent(t Table, options ExportOptions) string {
+	content := new(bytes.Buffer)
+
+	content.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range t {
+		content.WriteString(fmt.Sprintf(`<row r="%d">`, i+1))
+		for j, cell := range row {
+			ref := fmt.Sprintf("%s%d", xlsxColumnName(j), i+1)
+			switch v := cell.(type) {
+			case string:
+				content.WriteString(fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t>`, ref))
+				xml.EscapeText(content, []byte(v))
+				content.WriteString(`</t></is></c>`)
+			case float64:
+				content.WriteString(fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, options.formatValue(v)))
+			}
+		}
+		content.WriteString(`</row>`)
+	}
+	content.WriteString(`</sheetData></worksheet>`)
+
+	return content.String()
+}
+
+//	xlsxColumnName converts zero based column index to its letters (0 -> A, 26 -> AA)
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+
+	return name
+}
@@ -6,6 +6,10 @@ import (
 
 type XMLExport struct {}
 
+func init() {
+	registerExportFormat(ExportFormat{Extension: "xml", ContentType: "application/xml", Description: "experiment document", Defaults: documentExportDefaults, Exporter: &XMLExport{}})
+}
+
 type XMLExportExperiment struct {
 	XMLName 			xml.Name 						`xml:"experiment"`
 	Detectors			[]XMLExportDetector				`xml:"detectors>detector"`
@@ -47,11 +51,15 @@ type XMLExportEndogenousControlDetector struct {
 	RawValues	[]string	`xml:"raw-values>raw-value"`
 }
 
-func (export *XMLExport) Export(e *Experiment) ([]byte, error) {
+func (export *XMLExport) Export(e *Experiment, options ExportOptions) ([]byte, error) {
+	e = exportedExperiment(e, options)
+
 	var endogenousControls  []XMLExportEndogenousControl
-	for endogenousControlName, endogenousControl := range e.EndogenousControls {
+	for _, endogenousControlName := range e.EndogenousControls.Names() {
+		endogenousControl := e.EndogenousControls[endogenousControlName]
 		var endogenousControlDetectors = []XMLExportEndogenousControlDetector{}
-		for detectorName, rawValues := range endogenousControl.Detectors {
+		for _, detectorName := range endogenousControl.Detectors.Names() {
+			rawValues := endogenousControl.Detectors[detectorName]
 			endogenousControlDetectors = append(endogenousControlDetectors, XMLExportEndogenousControlDetector{Name: detectorName, RawValues: rawValues})
 		}
 
@@ -59,9 +67,11 @@ func (export *XMLExport) Export(e *Experiment) ([]byte, error) {
 	}
 
 	var detectors []XMLExportDetector
-	for detectorName, detector := range e.Detectors {
+	for _, detectorName := range e.Detectors.Names() {
+		detector := e.Detectors[detectorName]
 		var targetGenes = []XMLExportTargetGene{}
-		for targetGeneName, targetGene := range detector {
+		for _, targetGeneName := range detector.Names() {
+			targetGene := detector[targetGeneName]
 			targetGenes = append(targetGenes, XMLExportTargetGene{Name: targetGeneName, RawValues: targetGene.RawValues, Values: targetGene.Values, Mean: targetGene.Mean, StdDev: targetGene.StdDev, DCt: targetGene.DCt, DdCt: targetGene.DdCt, DdCtErr: targetGene.DdCtErr, RQ: targetGene.RQ, RQErr: targetGene.RQErr})
 		}
 
@@ -78,7 +88,3 @@ func (export *XMLExport) Export(e *Experiment) ([]byte, error) {
 	return xmlContent, nil
 }
 
-func (export *XMLExport) ContentType() string {
-	return "application/xml"
-}
-
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+
+	//	jobRetryAfter is suggested to clients polling unfinished jobs
+	jobRetryAfter = "1"
+)
+
+var (
+	ErrJobQueueFull   = errors.New("job queue is full")
+	ErrJobQueueClosed = errors.New("job queue is closed")
+
+	//	jobQueue runs computations of uploads sent with Prefer: respond-async
+	jobQueue *JobQueue
+)
+
+//	Job is an asynchronous experiment computation, Problem describes why a failed job
+//	failed and ExperimentId is set when it is done
+type Job struct {
+	JobId, Status, Instrument, ExperimentId string
+	CreatedAt, UpdatedAt                    time.Time
+	Warnings                                Diagnostics
+	Problem                                 *Problem
+
+	ctx context.Context
+	run func(ctx context.Context, jobId string) (string, Diagnostics, error)
+}
+
+type JobStore interface {
+	//	Save stores the state of the job until ttl after this update
+	Save(job Job, ttl time.Duration) error
+	Load(jobId string) (Job, bool, error)
+}
+
+//	newJobStore returns the redis store shared by all api instances or the in-process
+//	memory store
+func newJobStore(backend string) (JobStore, error) {
+	switch backend {
+	case "redis":
+		return &redisJobStore{}, nil
+	case "memory":
+		return newMemoryJobStore(), nil
+	}
+
+	return nil, fmt.Errorf("job backend '%s' is not valid", backend)
+}
+
+//	JobQueue runs jobs on a fixed number of workers of this instance and keeps their
+//	state in the store until ttl after they finished, so with the redis store any
+//	instance answers polls. Jobs of an instance which died stay queued or running
+//	until they expire.
+type JobQueue struct {
+	sync.Mutex
+	store   JobStore
+	queue   chan *Job
+	closed  bool
+	ttl     time.Duration
+	workers sync.WaitGroup
+	now     func() time.Time
+}
+
+func newJobQueue(store JobStore, workers, size int, ttl time.Duration) *JobQueue {
+	jq := &JobQueue{store: store, queue: make(chan *Job, size), ttl: ttl, now: time.Now}
+	for i := 0; i < workers; i++ {
+		jq.workers.Add(1)
+		go jq.work()
+	}
+
+	return jq
+}
+
+//	Submit queues the computation, the context only carries values like the request id
+func (jq *JobQueue) Submit(ctx context.Context, instrument string, run func(ctx context.Context, jobId string) (string, Diagnostics, error)) (Job, error) {
+	jobId, err := randomHex(16)
+	if err != nil {
+		return Job{}, err
+	}
+
+	jq.Lock()
+	defer jq.Unlock()
+
+	if jq.closed {
+		return Job{}, ErrJobQueueClosed
+	}
+
+	timeNow := jq.now()
+	job := &Job{JobId: jobId, Status: jobQueued, Instrument: instrument, CreatedAt: timeNow, UpdatedAt: timeNow, ctx: context.WithoutCancel(ctx), run: run}
+
+	//	the job is saved before a worker can update it, when the queue is full the
+	//	saved job expires unseen because its id is not returned
+	if err = jq.store.Save(*job, jq.ttl); err != nil {
+		return Job{}, err
+	}
+	queued := *job
+	select {
+	case jq.queue <- job:
+	default:
+		return Job{}, ErrJobQueueFull
+	}
+
+	return queued, nil
+}
+
+//	Get returns the job from the store
+func (jq *JobQueue) Get(jobId string) (Job, bool, error) {
+	return jq.store.Load(jobId)
+}
+
+//	Len returns the number of jobs waiting for a worker
+func (jq *JobQueue) Len() int {
+	return len(jq.queue)
+}
+
+//	Close stops accepting jobs and waits until the queued jobs are finished or the
+//	context is done
+func (jq *JobQueue) Close(ctx context.Context) error {
+	jq.Lock()
+	if !jq.closed {
+		jq.closed = true
+		close(jq.queue)
+	}
+	jq.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		jq.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (jq *JobQueue) work() {
+	defer jq.workers.Done()
+
+	for job := range jq.queue {
+		jq.update(job, func(job *Job) { job.Status = jobRunning })
+
+		expId, warnings, err := jq.run(job)
+		jq.update(job, func(job *Job) {
+			if err != nil {
+				problem := computationProblem(err)
+				job.Status, job.Problem = jobFailed, &problem
+				return
+			}
+			job.Status, job.ExperimentId, job.Warnings = jobDone, expId, warnings
+		})
+
+		slog.InfoContext(job.ctx, "job finished", "component", "jobs", "job_id", job.JobId, "status", job.Status)
+	}
+}
+
+//	run computes the job, a panic fails the job instead of stopping the api
+func (jq *JobQueue) run(job *Job) (expId string, warnings Diagnostics, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(job.ctx, "job panicked", "component", "jobs", "job_id", job.JobId, "panic", p, "stack", string(debug.Stack()))
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	return job.run(job.ctx, job.JobId)
+}
+
+//	update changes the job owned by the worker and saves it, a failed save leaves
+//	the previous state visible to polls
+func (jq *JobQueue) update(job *Job, change func(job *Job)) {
+	change(job)
+	job.UpdatedAt = jq.now()
+
+	if err := jq.store.Save(*job, jq.ttl); err != nil {
+		slog.ErrorContext(job.ctx, "saving job failed", "component", "jobs", "job_id", job.JobId, "status", job.Status, "error", err)
+	}
+}
+
+//	memoryJobStore keeps jobs in process memory, it is meant for running a single api
+//	instance
+type memoryJobStore struct {
+	sync.Mutex
+	jobs map[string]storedJob
+	now  func() time.Time
+}
+
+type storedJob struct {
+	job       Job
+	expiresAt time.Time
+}
+
+func newMemoryJobStore() *memoryJobStore {
+	return &memoryJobStore{jobs: make(map[string]storedJob), now: time.Now}
+}
+
+func (ms *memoryJobStore) Save(job Job, ttl time.Duration) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	timeNow := ms.now()
+	ms.sweep(timeNow)
+
+	//	the computation keeps the upload, it is not needed after saving
+	job.ctx, job.run = nil, nil
+	ms.jobs[job.JobId] = storedJob{job: job, expiresAt: timeNow.Add(ttl)}
+
+	return nil
+}
+
+func (ms *memoryJobStore) Load(jobId string) (Job, bool, error) {
+	ms.Lock()
+	defer ms.Unlock()
+
+	stored, found := ms.jobs[jobId]
+	if !found || !ms.now().Before(stored.expiresAt) {
+		return Job{}, false, nil
+	}
+
+	return stored.job, true, nil
+}
+
+//	sweep drops jobs which expired
+func (ms *memoryJobStore) sweep(timeNow time.Time) {
+	for jobId, stored := range ms.jobs {
+		if !timeNow.Before(stored.expiresAt) {
+			delete(ms.jobs, jobId)
+		}
+	}
+}
+
+//	preferAsync reports whether the client asked for an asynchronous response
+func preferAsync(r *http.Request) bool {
+	for _, preference := range splitHeaderList(r.Header.Values("Prefer")) {
+		if strings.EqualFold(strings.TrimSpace(strings.Split(preference, ";")[0]), "respond-async") {
+			return true
+		}
+	}
+
+	return false
+}
+
+//	submitExperimentJob queues the computation and responds with 202 pointing to the job,
+//	the reserved upload is given back when the job is not queued or fails
+func submitExperimentJob(w http.ResponseWriter, r *http.Request, crl ConsumerRateLimit, reservedAt time.Time, expComputer ExperimentComputer, cb Callback, instrument string, source []byte, filename string) {
+	job, err := jobQueue.Submit(r.Context(), instrument, func(ctx context.Context, jobId string) (string, Diagnostics, error) {
+		expId, _, _, warnings, err := computeExperiment(ctx, expComputer, instrument, source, filename, crl.owner())
+		notifyCallback(ctx, cb, jobId, expId, warnings, err)
+		if err != nil {
+			releaseUpload(ctx, crl, reservedAt)
+		}
+		return expId, warnings, err
+	})
+	if err != nil {
+		releaseUpload(r.Context(), crl, reservedAt)
+	}
+	if err == ErrJobQueueFull || err == ErrJobQueueClosed {
+		slog.WarnContext(r.Context(), "submitting job failed", "component", "jobs", "error", err)
+		w.Header().Set("Retry-After", "10")
+		writeProblem(w, r, http.StatusServiceUnavailable, "job_queue_unavailable", err.Error())
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "submitting job failed", "component", "jobs", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "submitting job failed")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "job queued", "component", "jobs", "job_id", job.JobId, "instrument", instrument)
+	w.Header().Set("Location", jobPath(r, job.JobId))
+	w.Header().Set("Preference-Applied", "respond-async")
+	writeJob(w, r, http.StatusAccepted, job)
+}
+
+//	writeJob responds with the job, unfinished jobs ask the client to poll again
+func writeJob(w http.ResponseWriter, r *http.Request, status int, job Job) {
+	if job.Problem != nil {
+		problem := *job.Problem
+		problem.Instance = jobPath(r, job.JobId)
+		job.Problem = &problem
+	}
+
+	content, err := json.Marshal(job)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling job failed", "component", "jobs", "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "marshalling job failed")
+		return
+	}
+
+	if job.Status == jobQueued || job.Status == jobRunning {
+		w.Header().Set("Retry-After", jobRetryAfter)
+	}
+	if job.Status == jobDone {
+		w.Header().Set("Content-Location", experimentPath(r, job.ExperimentId))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+//	jobsHandler reports the status of a job:
+//
+//	/v1/jobs/{id}    GET
+//	/v2/jobs/{id}    GET
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobId := r.PathValue("id")
+	if urlPath := strings.Split(r.URL.Path[1:], "/"); len(jobId) == 0 && len(urlPath) == 3 {
+		jobId = urlPath[2]
+	}
+	if len(jobId) == 0 {
+		slog.WarnContext(r.Context(), "path is not valid", "component", "jobs", "path", r.URL.Path)
+		writeProblem(w, r, http.StatusNotFound, "not_found", "path is not valid")
+		return
+	}
+
+	job, found, err := jobQueue.Get(jobId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "loading job failed", "component", "jobs", "job_id", jobId, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "loading job failed")
+		return
+	}
+	if !found {
+		slog.InfoContext(r.Context(), "job not found", "component", "jobs", "job_id", jobId)
+		writeProblem(w, r, http.StatusNotFound, "job_not_found", "job not found")
+		return
+	}
+
+	writeJob(w, r, http.StatusOK, job)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitForJob(t *testing.T, jq *JobQueue, jobId string) Job {
+	for i := 0; i < 200; i++ {
+		job, _, _ := jq.Get(jobId)
+		if job.Status == jobDone || job.Status == jobFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("Job '%s' did not finish!", jobId)
+	return Job{}
+}
+
+func TestJobQueue(t *testing.T) {
+	jq := newJobQueue(newMemoryJobStore(), 2, 10, time.Hour)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	run := func(ctx context.Context, jobId string) (string, Diagnostics, error) {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return "exp", Diagnostics{}, nil
+	}
+
+	jobIds := []string{}
+	for i := 0; i < 4; i++ {
+		job, err := jq.Submit(context.Background(), "ab7300", run)
+		if err != nil {
+			t.Fatalf("Submitting job failed with error: %s", err)
+		}
+		if job.Status != jobQueued {
+			t.Errorf("Submitted job should be queued, got '%s'", job.Status)
+		}
+		jobIds = append(jobIds, job.JobId)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for _, jobId := range jobIds {
+		if job := waitForJob(t, jq, jobId); job.Status != jobDone || job.ExperimentId != "exp" {
+			t.Errorf("Job should be done with experiment 'exp', got %#v", job)
+		}
+	}
+	if maxRunning != 2 {
+		t.Errorf("Two jobs should run at once, got %d", maxRunning)
+	}
+
+	job, _ := jq.Submit(context.Background(), "ab7300", func(ctx context.Context, jobId string) (string, Diagnostics, error) {
+		return "", nil, &ComputeError{Code: "invalid_content", Message: "content is not valid"}
+	})
+	job = waitForJob(t, jq, job.JobId)
+	if job.Status != jobFailed || job.Problem == nil || job.Problem.Status != http.StatusBadRequest || job.Problem.Code != "invalid_content" {
+		t.Errorf("Job should fail with invalid_content problem, got %#v", job)
+	}
+
+	if err := jq.Close(context.Background()); err != nil {
+		t.Errorf("Closing job queue failed with error: %s", err)
+	}
+	if _, err := jq.Submit(context.Background(), "ab7300", run); err != ErrJobQueueClosed {
+		t.Errorf("Submitting to closed queue should fail with ErrJobQueueClosed, got %v", err)
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	jq := newJobQueue(newMemoryJobStore(), 0, 1, time.Hour)
+	run := func(ctx context.Context, jobId string) (string, Diagnostics, error) { return "exp", nil, nil }
+
+	if _, err := jq.Submit(context.Background(), "ab7300", run); err != nil {
+		t.Fatalf("Submitting job failed with error: %s", err)
+	}
+	if _, err := jq.Submit(context.Background(), "ab7300", run); err != ErrJobQueueFull {
+		t.Errorf("Submitting to full queue should fail with ErrJobQueueFull, got %v", err)
+	}
+}
+
+func TestJobQueuePanic(t *testing.T) {
+	jq := newJobQueue(newMemoryJobStore(), 1, 1, time.Hour)
+
+	job, _ := jq.Submit(context.Background(), "ab7300", func(ctx context.Context, jobId string) (string, Diagnostics, error) {
+		panic("computation bug")
+	})
+	job = waitForJob(t, jq, job.JobId)
+	if job.Status != jobFailed || job.Problem == nil || job.Problem.Status != http.StatusInternalServerError {
+		t.Errorf("Panicking job should fail with internal error, got %#v", job)
+	}
+
+	job, _ = jq.Submit(context.Background(), "ab7300", func(ctx context.Context, jobId string) (string, Diagnostics, error) { return "exp", nil, nil })
+	if job = waitForJob(t, jq, job.JobId); job.Status != jobDone {
+		t.Errorf("Worker should keep running after a panic, got %#v", job)
+	}
+}
+
+func TestMemoryJobStore(t *testing.T) {
+	timeNow := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ms := newMemoryJobStore()
+	ms.now = func() time.Time { return timeNow }
+
+	if err := ms.Save(Job{JobId: "abc", Status: jobDone, ExperimentId: "exp"}, time.Minute); err != nil {
+		t.Fatalf("Saving job failed with error: %s", err)
+	}
+	if job, found, _ := ms.Load("abc"); !found || job.ExperimentId != "exp" {
+		t.Errorf("Saved job should be found, got %t %#v", found, job)
+	}
+
+	timeNow = timeNow.Add(time.Minute)
+	if _, found, _ := ms.Load("abc"); found {
+		t.Error("Job should expire ttl after it was saved!")
+	}
+	ms.Save(Job{JobId: "def"}, time.Minute)
+	if len(ms.jobs) != 1 {
+		t.Errorf("Expired jobs should be swept, got %d jobs", len(ms.jobs))
+	}
+}
+
+func TestRedisJobStore(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	js, err := newJobStore("redis")
+	if err != nil {
+		t.Fatalf("Redis job store failed with error: %s", err)
+	}
+	if _, err = newJobStore("disk"); err == nil {
+		t.Error("Unknown job backend should fail!")
+	}
+
+	problem := newProblem(http.StatusBadRequest, "invalid_content", "content is not valid", nil)
+	if err = js.Save(Job{JobId: "abc", Status: jobFailed, Instrument: "ab7300", Problem: &problem}, time.Minute); err != nil {
+		t.Fatalf("Saving job failed with error: %s", err)
+	}
+
+	job, found, err := js.Load("abc")
+	if err != nil || !found || job.Status != jobFailed || job.Problem == nil || job.Problem.Code != "invalid_content" {
+		t.Errorf("Saved job should be loaded with its problem, got %t %#v %v", found, job, err)
+	}
+	if _, found, err = js.Load("unknown"); found || err != nil {
+		t.Errorf("Unknown job should not be found, got %t %v", found, err)
+	}
+}
+
+func TestJobsHandler(t *testing.T) {
+	jobQueue = newJobQueue(newMemoryJobStore(), 0, 1, time.Hour)
+	defer func() { jobQueue = nil }()
+
+	job, _ := jobQueue.Submit(context.Background(), "ab7300", func(ctx context.Context, jobId string) (string, Diagnostics, error) { return "exp", nil, nil })
+
+	w := httptest.NewRecorder()
+	jobsHandler(w, httptest.NewRequest("GET", "/v1/jobs/"+job.JobId, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Retry-After") != jobRetryAfter {
+		t.Errorf("Queued job should be 200 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	jobsHandler(w, httptest.NewRequest("GET", "/v1/jobs/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Unknown job should be 404, got %d", w.Code)
+	}
+}
+
+func TestPreferAsync(t *testing.T) {
+	for prefer, expected := range map[string]bool{
+		"":                                       false,
+		"respond-async":                          true,
+		"return=minimal, Respond-Async; wait=10": true,
+		"return=representation":                  false,
+	} {
+		r := httptest.NewRequest("POST", "/v1/qpcr/ab7300", nil)
+		r.Header.Set("Prefer", prefer)
+		if preferAsync(r) != expected {
+			t.Errorf("preferAsync for '%s' should be %t", prefer, expected)
+		}
+	}
+}
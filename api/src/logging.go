@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	redacted = "[REDACTED]"
+)
+
+var (
+	//	secretLogKeys are attribute keys whose values are never written to the log
+	secretLogKeys = []string{"token", "consumer_token", "authorization", "admin_token", "hash"}
+
+	//	secretHeaders are request headers whose values are never written to the log
+	secretHeaders = []string{"Authorization", "Consumer-Token", "Cookie", "Proxy-Authorization"}
+)
+
+//	requestIdHandler adds the request id of the context to every record
+type requestIdHandler struct {
+	slog.Handler
+}
+
+func (h requestIdHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestId, ok := ctx.Value(requestIdContextKey).(string); ok {
+		record.AddAttrs(slog.String("request_id", requestId))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIdHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIdHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIdHandler) WithGroup(name string) slog.Handler {
+	return requestIdHandler{h.Handler.WithGroup(name)}
+}
+
+//	newLogger returns a json or logfmt logger writing records of the level and above
+func newLogger(out io.Writer, format, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level '%s' is not debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(requestIdHandler{slog.NewJSONHandler(out, options)}), nil
+	case "logfmt", "text":
+		return slog.New(requestIdHandler{slog.NewTextHandler(out, options)}), nil
+	}
+
+	return nil, fmt.Errorf("log format '%s' is not json or logfmt", format)
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if containsString(secretLogKeys, strings.ToLower(a.Key)) {
+		return slog.String(a.Key, redacted)
+	}
+
+	return a
+}
+
+//	redactHeaders returns a copy of the headers with credentials replaced
+func redactHeaders(header http.Header) http.Header {
+	redactedHeader := header.Clone()
+	for _, name := range secretHeaders {
+		if _, found := redactedHeader[name]; found {
+			redactedHeader[name] = []string{redacted}
+		}
+	}
+
+	return redactedHeader
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := newLogger(&out, "json", "info")
+	if err != nil {
+		t.Fatalf("Creating json logger failed with error: %s", err)
+	}
+
+	ctx := context.WithValue(context.Background(), requestIdContextKey, "abc123")
+	logger.DebugContext(ctx, "parser details")
+	logger.InfoContext(ctx, "token issued", "token_id", "t1", "token", "secret-token")
+
+	content := out.String()
+	if strings.Contains(content, "parser details") {
+		t.Errorf("Debug record should be filtered at info level, got:\n%s", content)
+	}
+	for _, expected := range []string{`"request_id":"abc123"`, `"token_id":"t1"`, `"token":"[REDACTED]"`} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("Log should contain '%s', got:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "secret-token") {
+		t.Errorf("Log should not contain the token, got:\n%s", content)
+	}
+
+	if _, err = newLogger(&out, "logfmt", "debug"); err != nil {
+		t.Errorf("Creating logfmt logger failed with error: %s", err)
+	}
+	if _, err = newLogger(&out, "xml", "info"); err == nil {
+		t.Error("Log format xml should not be valid!")
+	}
+	if _, err = newLogger(&out, "json", "verbose"); err == nil {
+		t.Error("Log level verbose should not be valid!")
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Consumer-Token", "secret-token")
+	header.Set("Authorization", "Bearer admin")
+	header.Set("Accept", "text/csv")
+
+	redactedHeader := redactHeaders(header)
+	if redactedHeader.Get("Consumer-Token") != redacted || redactedHeader.Get("Authorization") != redacted {
+		t.Errorf("Credentials should be redacted, got %v", redactedHeader)
+	}
+	if redactedHeader.Get("Accept") != "text/csv" {
+		t.Errorf("Accept should be kept, got '%s'", redactedHeader.Get("Accept"))
+	}
+	if header.Get("Consumer-Token") != "secret-token" {
+		t.Error("Request headers should not be modified!")
+	}
+}
@@ -1,3 +1,6 @@
+//	the api is built without go.mod, GOPATH builds default to the Go 1.21 ServeMux
+//	which does not match the wildcards of the /v2 routes
+//go:debug httpmuxgo121=0
 package main
 
 import (
@@ -5,12 +8,49 @@ import (
 	"time"
 	"github.com/garyburd/redigo/redis"
 	"log"
-	"strconv"
+	"log/slog"
 	"flag"
+	"os"
+	"runtime"
 )
 
+//	routes of the api, /v2 routes use http.ServeMux wildcards read with r.PathValue.
+//	Job polling, rate limit query, status, readiness, the OpenAPI document, formats and
+//	metrics do not count against the limit
+var routes = []Route{
+	{"/v1/qpcr/", []string{"POST"}, rateLimitCount, qpcrHandler},
+	{"/v1/experiment/", []string{"GET", "HEAD", "DELETE"}, rateLimitCount, experimentHandler},
+	{"/v1/experiments", []string{"GET"}, rateLimitCount, experimentsHandler},
+	{"/v1/projects", []string{"GET", "POST"}, rateLimitCount, projectsHandler},
+	{"/v1/project/", []string{"GET", "PUT", "DELETE"}, rateLimitCount, projectHandler},
+	{"/v1/admin/tokens", []string{"GET", "POST"}, rateLimitExempt, adminTokensHandler},
+	{"/v1/admin/tokens/", []string{"GET", "POST", "DELETE"}, rateLimitExempt, adminTokensHandler},
+	{"/v1/jobs/", []string{"GET"}, rateLimitPeek, jobsHandler},
+	{"/v2/experiments", []string{"GET", "POST"}, rateLimitCount, experimentsV2Handler},
+	{"/v2/experiments/{id}", []string{"GET", "HEAD", "DELETE"}, rateLimitCount, experimentV2Handler},
+	{"/v2/experiments/{id}/results", []string{"GET", "HEAD"}, rateLimitCount, experimentResultsHandler},
+	{"/v2/experiments/{id}/source", []string{"GET", "HEAD"}, rateLimitCount, experimentSourceHandler},
+	{"/v2/experiments/{id}/qc", []string{"GET"}, rateLimitCount, experimentQCHandler},
+	{"/v2/jobs/{id}", []string{"GET"}, rateLimitPeek, jobsHandler},
+	{"/v1/rate-limit", []string{"GET"}, rateLimitPeek, rateLimitHandler},
+	{"/v1/status", []string{"GET", "HEAD"}, rateLimitExempt, statusHandler},
+	{"/v1/ready", []string{"GET", "HEAD"}, rateLimitExempt, readyHandler},
+	{"/v1/openapi.json", []string{"GET"}, rateLimitExempt, openapiHandler},
+	{"/v1/formats", []string{"GET"}, rateLimitExempt, formatsHandler},
+	{"/metrics", []string{"GET"}, rateLimitExempt, metricsHandler},
+}
+
 var (
-	httpServerPort int
+	serverConfig ServerConfig
+	rateLimitBackend string
+	jobBackend string
+	trustedProxiesFlag string
+	clientIPHeaderFlag string
+	corsOriginsFlag string
+	logFormat string
+	logLevel string
+	jobWorkers int
+	jobQueueSize int
 )
 
 func init() {
@@ -19,7 +59,26 @@ func init() {
 		usage       			= "http server port"
 	)
 
-	flag.IntVar(&httpServerPort, "port", defaultHttpServerPort, usage)
+	flag.IntVar(&serverConfig.Port, "port", defaultHttpServerPort, usage)
+	flag.DurationVar(&serverConfig.ReadHeaderTimeout, "read-header-timeout", 10 * time.Second, "how long reading request headers may take")
+	flag.DurationVar(&serverConfig.ReadTimeout, "read-timeout", 5 * time.Minute, "how long reading a request including the upload may take")
+	flag.DurationVar(&serverConfig.WriteTimeout, "write-timeout", 5 * time.Minute, "how long writing a response may take")
+	flag.DurationVar(&serverConfig.IdleTimeout, "idle-timeout", 2 * time.Minute, "how long keep-alive connections wait for the next request")
+	flag.DurationVar(&serverConfig.ShutdownTimeout, "shutdown-timeout", 30 * time.Second, "how long in-flight requests, jobs and callbacks are drained on SIGTERM, pending callbacks are cancelled after it")
+	flag.DurationVar(&serverConfig.ShutdownDrainDelay, "shutdown-drain-delay", 5 * time.Second, "how long readiness fails on SIGTERM before new connections are refused")
+	flag.StringVar(&serverConfig.TLSCertFile, "tls-cert", "", "TLS certificate file, serves HTTPS together with tls-key")
+	flag.StringVar(&serverConfig.TLSKeyFile, "tls-key", "", "TLS private key file")
+	flag.StringVar(&trustedProxiesFlag, "trusted-proxies", "127.0.0.1/32,::1/128", "comma separated CIDRs of proxies allowed to set the client ip header")
+	flag.StringVar(&clientIPHeaderFlag, "client-ip-header", clientIPHeader, "header the trusted proxies overwrite with the client address, X-Real-Ip, X-Forwarded-For or Forwarded")
+	flag.StringVar(&corsOriginsFlag, "cors-origins", "*", "comma separated origins allowed to call the api, * allows any origin")
+	flag.DurationVar(&corsConfig.MaxAge, "cors-max-age", corsConfig.MaxAge, "how long browsers may cache preflight responses")
+	flag.StringVar(&logFormat, "log-format", "json", "log format, json or logfmt")
+	flag.StringVar(&logLevel, "log-level", "info", "log level, debug, info, warn or error")
+	flag.Int64Var(&serverMaxUploadSize, "max-upload-size", 64<<20, "max upload size in bytes of every tier, also after decompression")
+	flag.IntVar(&jobWorkers, "job-workers", runtime.NumCPU(), "number of asynchronous computations running at once")
+	flag.IntVar(&jobQueueSize, "job-queue-size", 100, "number of asynchronous computations waiting for a worker")
+	flag.StringVar(&rateLimitBackend, "ratelimit-backend", "redis", "rate limit buckets storage, redis or memory (single instance only)")
+	flag.StringVar(&jobBackend, "job-backend", "redis", "asynchronous job state storage, redis or memory (single instance only)")
 
 	redisPool = &redis.Pool{
 		MaxIdle: 5,
@@ -36,11 +95,46 @@ func init() {
 }
 
 func main() {
-	log.Println("api.qpcrbox.com")
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		os.Exit(tokenCommand(os.Args[2:]))
+	}
+
+	flag.Parse()
 
-	http.HandleFunc("/v1/qpcr/", qpcrHandler)
-	http.HandleFunc("/v1/experiment/", experimentHandler)
-	http.HandleFunc("/v1/rate-limit", rateLimitHandler)
-	http.HandleFunc("/v1/status", statusHandler)
-	http.ListenAndServe(":" + strconv.Itoa(httpServerPort), nil)
+	logger, err := newLogger(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	if rateLimiter, err = newRateLimiter(rateLimitBackend); err != nil {
+		log.Fatal(err)
+	}
+	if trustedProxies, err = parseTrustedProxies(trustedProxiesFlag); err != nil {
+		log.Fatal(err)
+	}
+	if clientIPHeader, err = parseClientIPHeader(clientIPHeaderFlag); err != nil {
+		log.Fatal(err)
+	}
+	corsConfig.AllowedOrigins = parseOrigins(corsOriginsFlag)
+	if jobWorkers < 1 || jobQueueSize < 0 {
+		log.Fatal("job workers must be at least 1 and job queue size can not be negative")
+	}
+	if err = serverConfig.validate(); err != nil {
+		log.Fatal(err)
+	}
+	jobStore, err := newJobStore(jobBackend)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jobQueue = newJobQueue(jobStore, jobWorkers, jobQueueSize, expirimentExpiresTime*time.Second)
+
+	slog.Info("api.qpcrbox.com", "port", serverConfig.Port, "tls", len(serverConfig.TLSCertFile) > 0, "version", version)
+
+	registerRoutes(http.DefaultServeMux, routes)
+	if err = serve(serverConfig, newServer(serverConfig, http.DefaultServeMux)); err != nil && err != http.ErrServerClosed {
+		slog.Error("server stopped", "component", "server", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("server stopped", "component", "server")
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//	metricVec is a counter or histogram partitioned by label values, written in the
+//	Prometheus text exposition format
+type metricVec struct {
+	sync.Mutex
+	name, help, kind string
+	labels           []string
+	buckets          []float64
+	series           map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+//	gaugeFunc is a gauge computed when metrics are scraped
+type gaugeFunc struct {
+	name, help string
+	value      func() float64
+}
+
+var (
+	latencyBuckets     = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	computationBuckets = []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30}
+
+	httpRequestsTotal         = newCounterVec("qpcrbox_http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status")
+	httpRequestDuration       = newHistogramVec("qpcrbox_http_request_duration_seconds", "HTTP request latency by route and status.", latencyBuckets, "route", "status")
+	uploadsTotal              = newCounterVec("qpcrbox_uploads_total", "Uploaded instrument files by instrument type.", "instrument")
+	parseFailuresTotal        = newCounterVec("qpcrbox_parse_failures_total", "Instrument files which could not be computed.", "instrument")
+	exportsTotal              = newCounterVec("qpcrbox_exports_total", "Experiment and project exports by format.", "format")
+	rateLimitRejectionsTotal  = newCounterVec("qpcrbox_rate_limit_rejections_total", "Requests rejected by rate limits and quotas.", "tier", "limit")
+	webhookDeliveriesTotal    = newCounterVec("qpcrbox_webhook_deliveries_total", "Callback deliveries by result, retried counts failed attempts which are retried and lost counts deliveries cancelled by shutdown.", "result")
+	experimentComputeDuration = newHistogramVec("qpcrbox_experiment_computation_duration_seconds", "Experiment computation duration by instrument type.", computationBuckets, "instrument")
+
+	metricVecs = []*metricVec{httpRequestsTotal, httpRequestDuration, uploadsTotal, parseFailuresTotal, exportsTotal, rateLimitRejectionsTotal, webhookDeliveriesTotal, experimentComputeDuration}
+
+	gaugeFuncs = []gaugeFunc{
+		{"qpcrbox_redis_pool_active_connections", "Redis connections in the pool, idle or in use.", func() float64 { return float64(redisPool.ActiveCount()) }},
+		{"qpcrbox_jobs_queued", "Asynchronous computations waiting for a worker.", func() float64 {
+			if jobQueue == nil {
+				return 0
+			}
+			return float64(jobQueue.Len())
+		}},
+		{"qpcrbox_redis_pool_idle_connections", "Idle redis connections in the pool.", func() float64 { return float64(redisPool.IdleCount()) }},
+	}
+)
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: make(map[string]*metricSeries)}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+func (mv *metricVec) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	ms, found := mv.series[key]
+	if !found {
+		ms = &metricSeries{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(mv.buckets))}
+		mv.series[key] = ms
+	}
+
+	return ms
+}
+
+func (mv *metricVec) Inc(labelValues ...string) {
+	mv.Lock()
+	defer mv.Unlock()
+
+	mv.get(labelValues).value++
+}
+
+//	Observe adds the value to the histogram, value keeps the sum of observations
+func (mv *metricVec) Observe(v float64, labelValues ...string) {
+	mv.Lock()
+	defer mv.Unlock()
+
+	ms := mv.get(labelValues)
+	for i, upper := range mv.buckets {
+		if v <= upper {
+			ms.counts[i]++
+		}
+	}
+	ms.count++
+	ms.value += v
+}
+
+func (mv *metricVec) write(w io.Writer) {
+	mv.Lock()
+	defer mv.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", mv.name, mv.help, mv.name, mv.kind)
+
+	keys := make([]string, 0, len(mv.series))
+	for key := range mv.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		ms := mv.series[key]
+		if mv.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", mv.name, formatLabels(mv.labels, ms.labelValues, "", ""), formatValue(ms.value))
+			continue
+		}
+
+		for i, upper := range mv.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", mv.name, formatLabels(mv.labels, ms.labelValues, "le", formatValue(upper)), ms.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", mv.name, formatLabels(mv.labels, ms.labelValues, "le", "+Inf"), ms.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", mv.name, formatLabels(mv.labels, ms.labelValues, "", ""), formatValue(ms.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", mv.name, formatLabels(mv.labels, ms.labelValues, "", ""), ms.count)
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+	}
+	if len(extraName) > 0 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+//	metricMethods are the methods counted under their own name, others are counted as
+//	"other" so arbitrary method tokens do not create new series
+var metricMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+
+func metricMethod(method string) string {
+	if containsString(metricMethods, method) {
+		return method
+	}
+
+	return "other"
+}
+
+//	withMetrics counts requests and observes their latency under the route pattern,
+//	so path parameters like experiment ids do not create new series
+func withMetrics(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeStart := time.Now()
+			sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+			next.ServeHTTP(sr, r)
+
+			status := strconv.Itoa(sr.status)
+			httpRequestsTotal.Inc(route, metricMethod(r.Method), status)
+			httpRequestDuration.Observe(time.Since(timeStart).Seconds(), route, status)
+		})
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var content bytes.Buffer
+
+	for _, mv := range metricVecs {
+		mv.write(&content)
+	}
+	for _, gf := range gaugeFuncs {
+		fmt.Fprintf(&content, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", gf.name, gf.help, gf.name, gf.name, formatValue(gf.value()))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(content.Bytes())
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestMetricVecWrite(t *testing.T) {
+	counter := newCounterVec("test_total", "Test counter.", "format")
+	counter.Inc("text/csv")
+	counter.Inc("text/csv")
+	counter.Inc("a\"b")
+
+	var content bytes.Buffer
+	counter.write(&content)
+	for _, line := range []string{
+		"# TYPE test_total counter",
+		`test_total{format="text/csv"} 2`,
+		`test_total{format="a\"b"} 1`,
+	} {
+		if !strings.Contains(content.String(), line+"\n") {
+			t.Errorf("Counter output should contain '%s', got:\n%s", line, content.String())
+		}
+	}
+
+	histogram := newHistogramVec("test_seconds", "Test histogram.", []float64{.1, 1}, "route")
+	histogram.Observe(.05, "/v1/qpcr/")
+	histogram.Observe(.5, "/v1/qpcr/")
+	histogram.Observe(5, "/v1/qpcr/")
+
+	content.Reset()
+	histogram.write(&content)
+	for _, line := range []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{route="/v1/qpcr/",le="0.1"} 1`,
+		`test_seconds_bucket{route="/v1/qpcr/",le="1"} 2`,
+		`test_seconds_bucket{route="/v1/qpcr/",le="+Inf"} 3`,
+		`test_seconds_sum{route="/v1/qpcr/"} 5.55`,
+		`test_seconds_count{route="/v1/qpcr/"} 3`,
+	} {
+		if !strings.Contains(content.String(), line+"\n") {
+			t.Errorf("Histogram output should contain '%s', got:\n%s", line, content.String())
+		}
+	}
+}
+
+//	seriesValue reads a series of a package metric, tests compare it before and after
+//	a request because the metrics are shared by all tests of the package
+func seriesValue(mv *metricVec, labelValues ...string) (float64, uint64) {
+	mv.Lock()
+	defer mv.Unlock()
+
+	ms, found := mv.series[strings.Join(labelValues, "\xff")]
+	if !found {
+		return 0, 0
+	}
+
+	return ms.value, ms.count
+}
+
+func TestWithMetrics(t *testing.T) {
+	redisPool = &redis.Pool{Dial: func() (redis.Conn, error) { return nil, errors.New("connection refused") }}
+	defer func() { redisPool = nil }()
+
+	requests, _ := seriesValue(httpRequestsTotal, "/v1/test/", "GET", "418")
+	_, observations := seriesValue(httpRequestDuration, "/v1/test/", "418")
+
+	handler := withMetrics("/v1/test/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/test/abc", nil))
+
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`qpcrbox_http_requests_total{route="/v1/test/",method="GET",status="418"} ` + formatValue(requests+1),
+		`qpcrbox_http_request_duration_seconds_count{route="/v1/test/",status="418"} ` + strconv.FormatUint(observations+1, 10),
+		"qpcrbox_redis_pool_active_connections 0",
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("Metrics should contain '%s', got:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestWithMetricsUnknownMethods(t *testing.T) {
+	handler := withMetrics("/v1/test/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	other, _ := seriesValue(httpRequestsTotal, "/v1/test/", "other", "405")
+	for _, method := range []string{"FOO", "BAR1", "get"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/v1/test/", nil))
+	}
+
+	if value, _ := seriesValue(httpRequestsTotal, "/v1/test/", "other", "405"); value != other+3 {
+		t.Errorf("Unknown methods should be counted as other, got %v before %v", value, other)
+	}
+	if value, _ := seriesValue(httpRequestsTotal, "/v1/test/", "FOO", "405"); value != 0 {
+		t.Errorf("Unknown method should not get its own series, got %v", value)
+	}
+}
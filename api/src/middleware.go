@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//	Middleware wraps a handler with behavior shared by routes
+type Middleware func(http.Handler) http.Handler
+
+type rateLimitMode int
+
+const (
+	//	rateLimitCount takes the request from the consumer bucket
+	rateLimitCount rateLimitMode = iota
+	//	rateLimitPeek resolves the consumer bucket without taking the request
+	rateLimitPeek
+	//	rateLimitExempt skips rate limiting
+	rateLimitExempt
+)
+
+//	Route describes an endpoint, Pattern is registered with http.ServeMux
+type Route struct {
+	Pattern   string
+	Methods   []string
+	RateLimit rateLimitMode
+	Handler   http.HandlerFunc
+}
+
+type contextKey int
+
+const (
+	requestIdContextKey contextKey = iota
+	rateLimitContextKey
+)
+
+var (
+	requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+)
+
+//	chain wraps the handler, the first middleware is the outermost one
+func chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+//	registerRoutes wraps every route with request id, logging, metrics, CORS, method
+//	and rate limit middleware, see cors.go for CORS and metrics.go for metrics
+func registerRoutes(mux *http.ServeMux, routes []Route) {
+	for _, route := range routes {
+		mux.Handle(route.Pattern, chain(route.Handler,
+			withRequestId,
+			withLogging,
+			withMetrics(route.Pattern),
+			withCORS(route.Methods),
+			withMethods(route.Methods),
+			withRateLimit(route.RateLimit),
+		))
+	}
+}
+
+//	withRequestId propagates a valid X-Request-Id or generates a new one
+func withRequestId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get("X-Request-Id")
+		if !requestIdPattern.MatchString(requestId) {
+			var err error
+			if requestId, err = randomHex(8); err != nil {
+				slog.ErrorContext(r.Context(), "generating request id failed", "component", "middleware", "error", err)
+			}
+		}
+
+		w.Header().Set("X-Request-Id", requestId)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIdContextKey, requestId)))
+	})
+}
+
+//	requestId returns the id assigned by withRequestId
+func requestId(r *http.Request) string {
+	requestId, _ := r.Context().Value(requestIdContextKey).(string)
+
+	return requestId
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeStart := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		slog.DebugContext(r.Context(), "request started", "component", "middleware", "method", r.Method, "path", r.URL.Path, "headers", redactHeaders(r.Header))
+
+		next.ServeHTTP(sr, r)
+
+		slog.InfoContext(r.Context(), "request", "component", "middleware", "method", r.Method, "path", r.URL.Path, "status", sr.status, "duration", time.Since(timeStart))
+	})
+}
+
+//	withMethods responds with 405 to methods the route does not serve
+func withMethods(methods []string) Middleware {
+	allow := strings.Join(methods, ", ") + ", OPTIONS"
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !containsString(methods, r.Method) {
+				slog.InfoContext(r.Context(), "method is not allowed", "component", "middleware", "method", r.Method, "path", r.URL.Path)
+				w.Header().Set("Allow", allow)
+				writeProblem(w, r, http.StatusMethodNotAllowed, "method_not_allowed", "method is not allowed")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//	withRateLimit checks the consumer bucket and stores the result in the request
+//	context, requests are rejected only in rateLimitCount mode
+func withRateLimit(mode rateLimitMode) Middleware {
+	return func(next http.Handler) http.Handler {
+		if mode == rateLimitExempt {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cost := 1
+			if mode == rateLimitPeek {
+				cost = 0
+			}
+
+			consumerRateLimit, err := takeRateLimit(r, cost)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "checking consumer rate limit failed", "component", "middleware", "error", err)
+				writeProblem(w, r, http.StatusInternalServerError, "internal_error", "checking consumer rate limit failed")
+				return
+			}
+
+			writeRateLimitHeaders(w, consumerRateLimit)
+			if mode == rateLimitCount && consumerRateLimit.Exceeded {
+				rateLimitRejectionsTotal.Inc(consumerRateLimit.Tier, "requests")
+				writeRateLimitExceeded(w, r, consumerRateLimit)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitContextKey, consumerRateLimit)))
+		})
+	}
+}
+
+//	requestRateLimit returns the consumer rate limit resolved by withRateLimit
+func requestRateLimit(r *http.Request) ConsumerRateLimit {
+	consumerRateLimit, _ := r.Context().Value(rateLimitContextKey).(ConsumerRateLimit)
+
+	return consumerRateLimit
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteMiddleware(t *testing.T) {
+	rateLimiter = newMemoryRateLimiter()
+	defer func() { rateLimiter = nil }()
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if requestRateLimit(r).Tier != anonymousTier {
+			t.Error("Rate limit is not available to the handler!")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	mux := http.NewServeMux()
+	registerRoutes(mux, []Route{
+		{"/counted", []string{"GET"}, rateLimitCount, ok},
+		{"/peek", []string{"GET"}, rateLimitPeek, ok},
+	})
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = "192.0.2.1:4000"
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("POST", "/counted"); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("POST should not be allowed, got %d %+v!", w.Code, w.Header())
+	}
+	if w := serve("OPTIONS", "/counted"); w.Code != http.StatusNoContent || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("OPTIONS request failed with %d %+v!", w.Code, w.Header())
+	}
+
+	for i := 0; i < anonymousLimits.RequestsBurst; i++ {
+		if w := serve("GET", "/peek"); w.Code != http.StatusNoContent || len(w.Header().Get("X-Request-Id")) == 0 {
+			t.Fatalf("Peeking request %d failed with %d %+v!", i+1, w.Code, w.Header())
+		}
+	}
+	for i := 0; i < anonymousLimits.RequestsBurst; i++ {
+		if w := serve("GET", "/counted"); w.Code != http.StatusNoContent {
+			t.Fatalf("Request %d within the burst failed with %d, peeking must not count!", i+1, w.Code)
+		}
+	}
+	if w := serve("GET", "/counted"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Request over the burst should be rejected, got %d!", w.Code)
+	}
+	if w := serve("GET", "/peek"); w.Code != http.StatusNoContent || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Peeking an exhausted bucket should succeed, got %d %+v!", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+)
+
+//	mediaRange is a media type of the Accept header with its quality
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+//	parseAccept parses the Accept header, ranges which are not valid are skipped
+func parseAccept(accept string) []mediaRange {
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		if len(strings.TrimSpace(part)) == 0 {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		if mediaType == "*" {
+			mediaType = "*/*"
+		}
+
+		q := 1.0
+		if value, found := params["q"]; found {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+
+	return ranges
+}
+
+//	specificity of the range matching the media type: 2 exact, 1 type/*, 0 */* and
+//	-1 when it does not match
+func (mr mediaRange) specificity(mediaType string) int {
+	switch {
+	case mr.mediaType == mediaType:
+		return 2
+	case strings.HasSuffix(mr.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mr.mediaType, "*")):
+		return 1
+	case mr.mediaType == "*/*":
+		return 0
+	}
+
+	return -1
+}
+
+//	negotiate returns the offer with the highest quality in the Accept header as in
+//	RFC 7231 section 5.3.2, the most specific range matching an offer sets its quality
+//	and ties go to the earlier offer. An empty header accepts the first offer.
+func negotiate(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if len(strings.TrimSpace(accept)) == 0 {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			if s := mr.specificity(offer); s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+//	requestExportFormat picks the export format of the response, the format query
+//	parameter and the path extension override the Accept header. It responds with 400
+//	for unknown formats and 406 when the Accept header matches none of the offers.
+func requestExportFormat(w http.ResponseWriter, r *http.Request, extension string, offers []string) (ExportFormat, bool) {
+	name := r.URL.Query().Get("format")
+	if len(name) == 0 {
+		name = extension
+	}
+
+	if len(name) > 0 {
+		format, found := findExportFormat(strings.ToLower(name))
+		if !found || !containsString(offers, format.ContentType) {
+			slog.WarnContext(r.Context(), "format is not valid", "component", "negotiate", "format", name)
+			writeProblem(w, r, http.StatusBadRequest, "unknown_format", fmt.Sprintf("format '%s' is not one of %s", name, strings.Join(exportFormatNames(offers), ", ")))
+			return ExportFormat{}, false
+		}
+		return format, true
+	}
+
+	accept := r.Header.Get("Accept")
+	contentType, ok := negotiate(accept, offers)
+	if !ok {
+		slog.WarnContext(r.Context(), "accept type is not acceptable", "component", "negotiate", "accept", accept)
+		writeProblem(w, r, http.StatusNotAcceptable, "not_acceptable", fmt.Sprintf("accept '%s' does not match any of %s", accept, strings.Join(offers, ", ")))
+		return ExportFormat{}, false
+	}
+	format, _ := findExportFormatByContentType(contentType)
+
+	return format, true
+}
+
+//	requestExportOptions overrides the format defaults with the precision, locale and
+//	raw-values query parameters
+func requestExportOptions(w http.ResponseWriter, r *http.Request, defaults ExportOptions) (ExportOptions, bool) {
+	options, err := parseExportOptions(r.URL.Query(), defaults)
+	if err != nil {
+		slog.WarnContext(r.Context(), "export options are not valid", "component", "negotiate", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_export_options", err.Error())
+		return ExportOptions{}, false
+	}
+
+	return options, true
+}
+
+func parseExportOptions(query url.Values, defaults ExportOptions) (ExportOptions, error) {
+	options := defaults
+	if value := query.Get("precision"); len(value) > 0 {
+		precision, err := strconv.Atoi(value)
+		if err != nil || precision < 0 || precision > exportMaxPrecision {
+			return options, fmt.Errorf("precision '%s' is not a number between 0 and %d", value, exportMaxPrecision)
+		}
+		options.Precision = precision
+	}
+	if value := query.Get("locale"); len(value) > 0 {
+		if !localePattern.MatchString(value) {
+			return options, fmt.Errorf("locale '%s' is not a language tag like en or de-AT", value)
+		}
+		options.Locale = value
+	}
+	if value := query.Get("raw-values"); len(value) > 0 {
+		rawValues, err := strconv.ParseBool(value)
+		if err != nil {
+			return options, fmt.Errorf("raw-values '%s' is not true or false", value)
+		}
+		options.RawValues = rawValues
+	}
+
+	return options, nil
+}
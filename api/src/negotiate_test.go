@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := exportContentTypes(false)
+
+	for accept, expected := range map[string]string{
+		"":                                       "application/json",
+		"*/*":                                    "application/json",
+		"*":                                      "application/json",
+		"text/*":                                 "text/csv",
+		"TEXT/CSV":                               "text/csv",
+		"text/csv;q=0.5, application/json;q=0.4": "text/csv",
+		"application/json;q=0, */*;q=0.1":        "text/csv",
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8":     "application/xml",
+		"application/vnd.oasis.opendocument.spreadsheet, application/*;q=0.2": "application/vnd.oasis.opendocument.spreadsheet",
+		"text/csv;q=2, application/json;q=0.3":                                "application/json",
+		"image/png":                                                           "",
+		"text/csv;q=0":                                                        "",
+	} {
+		contentType, ok := negotiate(accept, offers)
+		if contentType != expected || ok != (len(expected) > 0) {
+			t.Errorf("Accept '%s' should negotiate '%s', got '%s' %v", accept, expected, contentType, ok)
+		}
+	}
+}
+
+func TestRequestExportFormat(t *testing.T) {
+	offers := exportContentTypes(false)
+
+	for _, tc := range []struct {
+		url, extension, accept string
+		status                 int
+		format                 string
+	}{
+		{"/v1/experiment/abc?format=csv", "", "application/json", http.StatusOK, "csv"},
+		{"/v1/experiment/abc.xlsx", "xlsx", "", http.StatusOK, "xlsx"},
+		{"/v1/experiment/abc.xlsx?format=ods", "xlsx", "", http.StatusOK, "ods"},
+		{"/v1/experiment/abc", "", "text/html,*/*;q=0.8", http.StatusOK, "json"},
+		{"/v1/experiment/abc.pdf", "pdf", "", http.StatusBadRequest, ""},
+		{"/v1/experiment/abc", "", "image/png", http.StatusNotAcceptable, ""},
+	} {
+		r := httptest.NewRequest("GET", tc.url, nil)
+		r.Header.Set("Accept", tc.accept)
+		w := httptest.NewRecorder()
+
+		format, ok := requestExportFormat(w, r, tc.extension, offers)
+		if tc.status != http.StatusOK {
+			if ok || w.Code != tc.status {
+				t.Errorf("%s should fail with %d, got %d", tc.url, tc.status, w.Code)
+			}
+			continue
+		}
+		if !ok || format.Extension != tc.format {
+			t.Errorf("%s should select %s, got %+v", tc.url, tc.format, format)
+		}
+	}
+
+	if disposition := attachmentDisposition("plate/1", ExportFormat{Extension: "csv"}); disposition != "attachment; filename=plate-1.csv" {
+		t.Errorf("Attachment should be named after the base name, got %s", disposition)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+)
+
+var (
+	//	openapiDocument describes every route of the api, openapi_test.go checks that it
+	//	matches the routes in main.go
+	//go:embed openapi.json
+	openapiDocument []byte
+)
+
+func openapiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(openapiDocument)))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(openapiDocument)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	openapiMethods  = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+	openapiWildcard = regexp.MustCompile(`\{[^}]+\}`)
+)
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapiDocument, &spec); err != nil || !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("openapi.json is not an OpenAPI 3 document: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	routesByPattern := make(map[string]Route)
+	documented := make(map[string]map[string]bool)
+	for _, route := range routes {
+		mux.Handle(route.Pattern, http.NotFoundHandler())
+		routesByPattern[route.Pattern] = route
+		documented[route.Pattern] = make(map[string]bool)
+	}
+	if _, pattern := mux.Handler(httptest.NewRequest("GET", "/v2/jobs/x", nil)); pattern != "/v2/jobs/{id}" {
+		t.Fatalf("ServeMux does not match wildcards, got pattern '%s', the build must set httpmuxgo121=0", pattern)
+	}
+
+	for path, operations := range spec.Paths {
+		_, pattern := mux.Handler(httptest.NewRequest("GET", openapiWildcard.ReplaceAllString(path, "x"), nil))
+		route, found := routesByPattern[pattern]
+		if !found {
+			t.Errorf("%s is documented but not routed", path)
+			continue
+		}
+
+		for method := range operations {
+			method = strings.ToUpper(method)
+			if !containsString(openapiMethods, method) {
+				continue
+			}
+			if !containsString(route.Methods, method) {
+				t.Errorf("%s %s is documented but route %s does not serve it", method, path, route.Pattern)
+			}
+			documented[route.Pattern][method] = true
+		}
+	}
+
+	for _, route := range routes {
+		for _, method := range route.Methods {
+			if !documented[route.Pattern][method] {
+				t.Errorf("%s %s is routed but not documented", method, route.Pattern)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	problemContentType = "application/problem+json"
+)
+
+//	Problem is an RFC 7807 problem details document, Code is a stable machine
+//	readable error code and Diagnostics point into the uploaded content
+type Problem struct {
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	Status      int         `json:"status"`
+	Detail      string      `json:"detail,omitempty"`
+	Instance    string      `json:"instance,omitempty"`
+	Code        string      `json:"code"`
+	RequestId   string      `json:"requestId,omitempty"`
+	Diagnostics Diagnostics `json:"diagnostics,omitempty"`
+}
+
+func newProblem(status int, code, detail string, diagnostics Diagnostics) Problem {
+	return Problem{
+		Type:        "about:blank",
+		Title:       http.StatusText(status),
+		Status:      status,
+		Detail:      detail,
+		Code:        code,
+		Diagnostics: diagnostics,
+	}
+}
+
+//	writeProblem responds with an application/problem+json document
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string, diagnostics ...Diagnostic) {
+	writeProblemDocument(w, r, newProblem(status, code, detail, diagnostics))
+}
+
+//	writeProblemDocument responds with the problem, the request path and id are filled in
+func writeProblemDocument(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Instance, problem.RequestId = r.URL.Path, requestId(r)
+	writeProblemContent(w, r, problem.Status, problem)
+}
+
+//	writeProblemContent responds with a problem document, documents with extension
+//	members embed a Problem filled in by the caller
+func writeProblemContent(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "marshalling problem failed", "component", "problem", "error", err)
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(content)
+}
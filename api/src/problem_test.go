@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/v1/qpcr/ab7300", nil)
+	writeProblem(w, r, http.StatusBadRequest, "invalid_content", "content is not valid", Diagnostic{Severity: severityError, Code: "missing_header", Line: 1, Value: "SDS v1.4"})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Status should be 400, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != problemContentType {
+		t.Errorf("Content-Type should be %s, got %s", problemContentType, contentType)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Problem is not valid json: %s", err)
+	}
+	if problem.Status != 400 || problem.Code != "invalid_content" || problem.Instance != "/v1/qpcr/ab7300" || len(problem.Diagnostics) != 1 || problem.Diagnostics[0].Line != 1 {
+		t.Errorf("Problem is not complete, got %#v", problem)
+	}
+}
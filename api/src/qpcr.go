@@ -1,13 +1,20 @@
 package main
 
+import (
+	"io"
+	"sort"
+)
+
 type DetectorMap map[string]DetectorTargetGeneMap
 type DetectorTargetGeneMap map[string]DetectorTargetGene
 type EndoTargetGeneMap map[string]EndoTargetGene
 type StringArrayMap map[string][]string
 
 type Experiment struct {
+	Instrument, Calibrator string
 	Detectors DetectorMap
 	EndogenousControls EndoTargetGeneMap
+	diagnostics Diagnostics
 }
 
 type DetectorTargetGene struct {
@@ -22,11 +29,101 @@ type EndoTargetGene struct {
 	Mean, StdDev 	float64
 }
 
-type ExperimentComputer interface {
-	Compute() (*Experiment, error)
+//	Names returns detector names in sorted order
+func (dm DetectorMap) Names() []string {
+	names := make([]string, 0, len(dm))
+	for name := range dm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//	Names returns target gene names in sorted order
+func (tgm DetectorTargetGeneMap) Names() []string {
+	names := make([]string, 0, len(tgm))
+	for name := range tgm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//	Names returns endogenous control names in sorted order
+func (etgm EndoTargetGeneMap) Names() []string {
+	names := make([]string, 0, len(etgm))
+	for name := range etgm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//	Names returns map keys in sorted order
+func (sam StringArrayMap) Names() []string {
+	names := make([]string, 0, len(sam))
+	for name := range sam {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+//	Instrument describes a supported instrument export, Detect recognizes the export
+//	from the beginning of an upload and NewComputer sets the calibrator sample
+type Instrument struct {
+	Name        string
+	Detect      func(content []byte) bool
+	NewComputer func(calibrator string) ExperimentComputer
 }
 
+var (
+	//	instruments are the experiment computers served by /v1/qpcr/{name} and /v2/experiments
+	instruments = []Instrument{
+		{"ab7300", detectAB7300, func(calibrator string) ExperimentComputer { return &AB7300{Mock: calibrator} }},
+	}
+)
+
+func findInstrument(name string) (Instrument, bool) {
+	for _, instrument := range instruments {
+		if instrument.Name == name {
+			return instrument, true
+		}
+	}
+
+	return Instrument{}, false
+}
+
+//	detectInstrument returns the instrument which recognizes the content
+func detectInstrument(content []byte) (Instrument, bool) {
+	for _, instrument := range instruments {
+		if instrument.Detect(content) {
+			return instrument, true
+		}
+	}
+
+	return Instrument{}, false
+}
+
+func instrumentNames() []string {
+	names := make([]string, 0, len(instruments))
+	for _, instrument := range instruments {
+		names = append(names, instrument.Name)
+	}
+
+	return names
+}
+
+//	ExperimentComputer computes an experiment from the instrument export read from r,
+//	problems of the content are returned as *ComputeError
+type ExperimentComputer interface {
+	Compute(r io.Reader) (*Experiment, error)
+}
 
 type AB7300 struct {
-	Content, Mock string
+	Mock string
 }
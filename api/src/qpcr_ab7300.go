@@ -1,46 +1,106 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"io"
 	"math"
 	"strconv"
 	"strings"
-	"log"
-	"errors"
+	"log/slog"
+	"fmt"
 )
 
-func (md *AB7300) Compute() (*Experiment, error) {
-	e := &Experiment{}
+const (
+	//	ab7300HeaderLines is how many lines are searched for the headers by detectAB7300
+	ab7300HeaderLines = 10
+)
+
+var (
+	ab7300Headers = []string{"Applied Biosystems 7300 Real-Time PCR System", "SDS v1.4"}
+)
+
+//	Compute reads the SDS export line by line, results are the rows of the 11th
+//	section, sections are separated by empty lines
+func (md *AB7300) Compute(r io.Reader) (*Experiment, error) {
+	e := &Experiment{Instrument: "ab7300", Calibrator: md.Mock}
 	e.Detectors = make(DetectorMap)
 	e.EndogenousControls = make(EndoTargetGeneMap)
 
-	if isContentValid(md.Content) {
-		section := 1
-		lines := strings.Split(md.Content, "\n")
-		for _, line := range lines {
-			if len(line) == 0 {
-				section++
-			} else {
-				switch section {
-				case 11:
-					e.parseRow(&line)
+	headers := make(map[string]bool)
+	section, lineNumber := 1, 0
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if len(line) == 0 {
+			section++
+			continue
+		}
+
+		switch {
+		case section == 11 && len(headers) == len(ab7300Headers):
+			e.parseRow(&line, lineNumber)
+		case section < 11:
+			for _, header := range ab7300Headers {
+				if strings.Contains(line, header) {
+					headers[header] = true
 				}
 			}
 		}
+	}
+
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return e, &ComputeError{Code: "line_too_long", Message: fmt.Sprintf("lines are limited to %d bytes", maxLineLength), Diagnostics: Diagnostics{{Severity: severityError, Code: "line_too_long", Message: "line is too long", Line: lineNumber + 1}}}
+	} else if err != nil {
+		return e, &ComputeError{Code: "invalid_content", Message: err.Error()}
+	}
+
+	if diagnostics := missingHeaders(headers); len(diagnostics) > 0 {
+		return e, &ComputeError{Code: "invalid_content", Message: "content is not an ab7300 SDS v1.4 export", Diagnostics: diagnostics}
+	}
+
+	if len(e.Detectors) == 0 && len(e.EndogenousControls) == 0 {
+		return e, &ComputeError{Code: "no_results", Message: "content does not contain any result rows", Diagnostics: e.diagnostics}
+	}
+
+	e.computeTargetGenes(md.Mock)
 
-		e.computeTargetGenes(md.Mock)
+	return e, nil
+}
 
-		return e, nil
+//	detectAB7300 looks for the SDS export headers in the lines before the results
+func detectAB7300(content []byte) bool {
+	headers := make(map[string]bool)
+	scanner := newLineScanner(bytes.NewReader(content))
+	for lineNumber := 0; lineNumber < ab7300HeaderLines && scanner.Scan(); lineNumber++ {
+		for _, header := range ab7300Headers {
+			if strings.Contains(scanner.Text(), header) {
+				headers[header] = true
+			}
+		}
 	}
 
-	return e, errors.New("[ab7300] content is not valid!")
+	return len(headers) == len(ab7300Headers)
 }
 
-func isContentValid(content string) bool {
-	return (strings.Contains(content, "Applied Biosystems 7300 Real-Time PCR System") && strings.Contains(content, "SDS v1.4"))
+//	missingHeaders reports the ab7300 header lines which were not found
+func missingHeaders(headers map[string]bool) Diagnostics {
+	diagnostics := Diagnostics{}
+	for _, header := range ab7300Headers {
+		if !headers[header] {
+			diagnostics = append(diagnostics, Diagnostic{Severity: severityError, Code: "missing_header", Message: "header is missing", Line: 1, Value: header})
+		}
+	}
+
+	return diagnostics
 }
 
 func (e *Experiment) computeTargetGenes(mockName string) {
-	endoControlMock := e.EndogenousControls[mockName]
+	endoControlMock, found := e.EndogenousControls[mockName]
+	if !found {
+		e.warn("mock_not_found", "mock is not an endogenous control", 0, 0, mockName)
+	}
 
 	e.computeMocks(mockName, endoControlMock)
 
@@ -80,25 +140,36 @@ func (e *Experiment) computeMocks(mockName string, endoControlMock EndoTargetGen
 
 			e.Detectors[detectorName][mockName] = targetGene
 		} else {
-			log.Printf("[ab7300] mock for detector '%s' not found!\n", detectorName)
+			slog.Debug("mock for detector not found", "component", "ab7300", "detector", detectorName, "mock", mockName)
+			e.warn("detector_mock_not_found", "mock is not measured by the detector", 0, 0, detectorName)
 		}
 	}
 }
 
-func (e *Experiment) parseRow(line *string) {
+//	parseRow adds the sample of the result row, lineNumber is used for diagnostics
+func (e *Experiment) parseRow(line *string, lineNumber int) {
 	rowValues := strings.Split(*line, ",")
 	if len(rowValues) == 22 {
 		name, detector, task, value := rowValues[3], rowValues[4], rowValues[5], rowValues[6]
+		if task == "Task" {
+			return
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil && (task == "ENDO" || task == "Target") {
+			e.warn("invalid_ct", "Ct value is not a number, it is left out", lineNumber, 7, value)
+		}
+
 		switch task {
 		case "ENDO":
 			e.addEndogenousControlTargetGeneValue(name, detector, value)
 		case "Target":
 			e.addDetectorTargetGeneValue(name, detector, value)
 		default:
-			log.Printf("[ab7300] ignoring unknown task type '%s'!\n", task)
+			slog.Debug("ignoring unknown task type", "component", "ab7300", "task", task)
+			e.warn("unknown_task", "task is not ENDO or Target, the row is ignored", lineNumber, 6, task)
 		}
 	} else {
-		log.Printf("[ab7300] line '%s' is not valid ab7300 line!\n", line)
+		slog.Debug("line is not valid ab7300 line", "component", "ab7300", "line", *line, "columns", len(rowValues))
+		e.warn("invalid_row", fmt.Sprintf("row has %d columns instead of 22, it is ignored", len(rowValues)), lineNumber, 0, *line)
 	}
 }
 
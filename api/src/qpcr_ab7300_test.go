@@ -1,13 +1,102 @@
 package main
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
+const ab7300TestContent = "Applied Biosystems 7300 Real-Time PCR System\nSDS v1.4" + "\n\n\n\n\n\n\n\n\n\n\n" +
+	"Plate,Well ID,Well,Sample,Detector,Task,Ct,Ct Std Err,Avg Ct,Avg dCt,dCt Std Err,ddCt,RQ,RQ Min,RQ Max,Omit,Filtered,Threshold,Auto Ct,Baseline,Start,End\n" +
+	"P,1,A1,mock,GAPDH,ENDO,20.1,,,,,,,,,,,,,,,\n" +
+	"P,2,A2,mock,IL8,Target,25.3,,,,,,,,,,,,,,,\n" +
+	"P,3,A3,mock,IL8,Target,Undet.,,,,,,,,,,,,,,,\n" +
+	"P,4,A4,mock,IL8,NTC,30.0,,,,,,,,,,,,,,,\n" +
+	"P,5,A5,broken\n"
+
 func TestContentValidity(t *testing.T) {
-	var md = AB7300{Content: "aaaa", Mock: "aaa"}
+	var md = AB7300{Mock: "aaa"}
 
-	if _, err := md.Compute(); err == nil {
+	if _, err := md.Compute(strings.NewReader("aaaa")); err == nil {
 		t.Error("Compute for wrong content did not fail!")
 	}
 }
+
+func TestComputeDiagnostics(t *testing.T) {
+	var md = AB7300{Mock: "aaa"}
+	_, err := md.Compute(strings.NewReader("aaaa"))
+	ce, ok := err.(*ComputeError)
+	if !ok || ce.Code != "invalid_content" || len(ce.Diagnostics) != 2 {
+		t.Fatalf("Compute for wrong content should fail with 2 missing headers, got %#v", err)
+	}
+
+	md = AB7300{Mock: "mock"}
+	e, err := md.Compute(strings.NewReader(ab7300TestContent))
+	if err != nil {
+		t.Fatalf("Compute failed with error: %s", err)
+	}
+
+	expected := []Diagnostic{
+		{Severity: severityWarning, Code: "invalid_ct", Line: 16, Column: 7, Value: "Undet."},
+		{Severity: severityWarning, Code: "unknown_task", Line: 17, Column: 6, Value: "NTC"},
+		{Severity: severityWarning, Code: "invalid_row", Line: 18, Value: "P,5,A5,broken"},
+	}
+	diagnostics := e.Diagnostics()
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Compute should report %d diagnostics, got %#v", len(expected), diagnostics)
+	}
+	for i, d := range diagnostics {
+		d.Message = ""
+		if d != expected[i] {
+			t.Errorf("Diagnostic %d should be %#v, got %#v", i, expected[i], d)
+		}
+	}
+}
+
+func TestDiagnosticValueTruncation(t *testing.T) {
+	e := &Experiment{}
+	e.warn("invalid_row", "row is not valid", 1, 0, strings.Repeat("x", diagnosticValueMaxLength-1)+"µ€")
+	e.warn("invalid_row", "row is not valid", 2, 0, strings.Repeat("€", diagnosticValueMaxLength))
+	e.warn("invalid_row", "row is not valid", 3, 0, strings.Repeat("x", diagnosticValueMaxLength))
+
+	for i, expected := range []string{
+		strings.Repeat("x", diagnosticValueMaxLength-1) + "...",
+		strings.Repeat("€", diagnosticValueMaxLength/3) + "...",
+		strings.Repeat("x", diagnosticValueMaxLength),
+	} {
+		if value := e.Diagnostics()[i].Value; value != expected || !utf8.ValidString(value) {
+			t.Errorf("Diagnostic value should be truncated to '%s', got '%s'", expected, value)
+		}
+	}
+}
+
+func TestComputeEncodings(t *testing.T) {
+	md := AB7300{Mock: "mock"}
+	expected, err := md.Compute(strings.NewReader(ab7300TestContent))
+	if err != nil {
+		t.Fatalf("Compute failed with error: %s", err)
+	}
+
+	crlf := strings.ReplaceAll(ab7300TestContent, "\n", "\r\n")
+	utf16le := []byte{0xff, 0xfe}
+	for _, unit := range utf16.Encode([]rune(crlf)) {
+		utf16le = append(utf16le, byte(unit), byte(unit>>8))
+	}
+
+	for name, content := range map[string][]byte{
+		"crlf":     []byte(crlf),
+		"utf8 bom": append([]byte{0xef, 0xbb, 0xbf}, ab7300TestContent...),
+		"utf16le":  utf16le,
+	} {
+		e, err := md.Compute(bytes.NewReader(content))
+		if err != nil {
+			t.Errorf("%s: Compute failed with error: %s", name, err)
+			continue
+		}
+		if e.Canonical() != expected.Canonical() || len(e.Diagnostics()) != len(expected.Diagnostics()) {
+			t.Errorf("%s: experiment should equal the LF experiment, got %#v", name, e)
+		}
+	}
+}
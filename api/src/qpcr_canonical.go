@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//	experimentSchemaVersion has to be increased whenever the canonical form or
+//	the computation changes, so old and new results never share an id
+const (
+	experimentSchemaVersion = 1
+)
+
+//	Canonical returns a deterministic serialisation of the experiment input
+//	(instrument, options and raw values) used for the content-addressed id.
+//	Detectors, samples and endogenous controls are written in sorted order,
+//	computed values are left out as they are derived from the raw values.
+func (e *Experiment) Canonical() string {
+	var content bytes.Buffer
+
+	content.WriteString(fmt.Sprintf("qpcrbox-experiment/%d\n", experimentSchemaVersion))
+	content.WriteString(fmt.Sprintf("instrument %s\n", strconv.Quote(e.Instrument)))
+	content.WriteString(fmt.Sprintf("calibrator %s\n", strconv.Quote(e.Calibrator)))
+
+	for _, endoName := range e.EndogenousControls.Names() {
+		endoTargetGene := e.EndogenousControls[endoName]
+		for _, detectorName := range endoTargetGene.Detectors.Names() {
+			content.WriteString(fmt.Sprintf("endo %s %s %s\n", strconv.Quote(endoName), strconv.Quote(detectorName), canonicalValues(endoTargetGene.Detectors[detectorName])))
+		}
+	}
+
+	for _, detectorName := range e.Detectors.Names() {
+		detector := e.Detectors[detectorName]
+		for _, targetGeneName := range detector.Names() {
+			content.WriteString(fmt.Sprintf("target %s %s %s\n", strconv.Quote(detectorName), strconv.Quote(targetGeneName), canonicalValues(detector[targetGeneName].RawValues)))
+		}
+	}
+
+	return content.String()
+}
+
+func canonicalValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(strings.TrimSpace(value))
+	}
+
+	return "[" + strings.Join(quoted, ",") + "]"
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalIgnoresInsertionOrder(t *testing.T) {
+	a := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	a.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+	a.addDetectorTargetGeneValue("Treated", "ACTB", "24.1")
+	a.addEndogenousControlTargetGeneValue("Mock", "18S", "12.0")
+	a.addEndogenousControlTargetGeneValue("Treated", "18S", "12.3")
+
+	b := &Experiment{Instrument: "ab7300", Calibrator: "Mock", Detectors: make(DetectorMap), EndogenousControls: make(EndoTargetGeneMap)}
+	b.addEndogenousControlTargetGeneValue("Treated", "18S", "12.3")
+	b.addDetectorTargetGeneValue("Treated", "ACTB", "24.1")
+	b.addEndogenousControlTargetGeneValue("Mock", "18S", "12.0")
+	b.addDetectorTargetGeneValue("Mock", "GAPDH", "21.5")
+
+	if getExpId(a.Canonical()) != getExpId(b.Canonical()) {
+		t.Error("Identical experiments have different ids!")
+	}
+
+	b.Calibrator = "Treated"
+	if getExpId(a.Canonical()) == getExpId(b.Canonical()) {
+		t.Error("Experiments with different calibrators have the same id!")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+
+	//	diagnosticValueMaxLength truncates offending values like whole lines
+	diagnosticValueMaxLength = 120
+	//	maxDiagnostics keeps responses for badly broken uploads small
+	maxDiagnostics = 100
+)
+
+//	Diagnostic points at a problem found in the uploaded content, Line and Column are
+//	1-based and zero when the problem is not tied to a position
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+type Diagnostics []Diagnostic
+
+//	ComputeError is returned by experiment computers when the content can not be
+//	computed, Diagnostics explain why
+type ComputeError struct {
+	Code, Message string
+	Diagnostics   Diagnostics
+}
+
+func (ce *ComputeError) Error() string {
+	return fmt.Sprintf("%s: %s (%d diagnostics)", ce.Code, ce.Message, len(ce.Diagnostics))
+}
+
+//	Diagnostics returns the warnings collected while computing the experiment
+func (e *Experiment) Diagnostics() Diagnostics {
+	return e.diagnostics
+}
+
+func (e *Experiment) warn(code, message string, line, column int, value string) {
+	if len(e.diagnostics) > maxDiagnostics {
+		return
+	}
+	if len(e.diagnostics) == maxDiagnostics {
+		e.diagnostics = append(e.diagnostics, Diagnostic{Severity: severityWarning, Code: "too_many_diagnostics", Message: fmt.Sprintf("only the first %d diagnostics are reported", maxDiagnostics)})
+		return
+	}
+
+	e.diagnostics = append(e.diagnostics, Diagnostic{Severity: severityWarning, Code: code, Message: message, Line: line, Column: column, Value: truncateDiagnosticValue(value)})
+}
+
+//	truncateDiagnosticValue cuts values longer than diagnosticValueMaxLength bytes at
+//	the last rune boundary, multi-byte characters are never split
+func truncateDiagnosticValue(value string) string {
+	if len(value) <= diagnosticValueMaxLength {
+		return value
+	}
+
+	end := diagnosticValueMaxLength
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+
+	return value[:end] + "..."
+}
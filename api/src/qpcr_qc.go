@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strconv"
+)
+
+const (
+	//	qcMaxReplicateStdDev is the Ct standard deviation above which replicates disagree
+	qcMaxReplicateStdDev = 0.5
+	//	qcLateCt is the Ct above which amplification is too late to be reliable
+	qcLateCt = 35.0
+)
+
+//	ReplicateQC summarizes the Ct replicates of a sample measured by a detector,
+//	Flags name the failed checks
+type ReplicateQC struct {
+	Detector, Sample, Task   string
+	Replicates, Undetermined int
+	Mean, StdDev             float64
+	Flags                    []string
+}
+
+//	QualityControl checks the replicates of target genes and endogenous controls,
+//	results are sorted by task, detector and sample
+func (e *Experiment) QualityControl() []ReplicateQC {
+	replicates := []ReplicateQC{}
+	for _, detectorName := range e.Detectors.Names() {
+		detector := e.Detectors[detectorName]
+		for _, sampleName := range detector.Names() {
+			replicates = append(replicates, replicateQC(detectorName, sampleName, "Target", detector[sampleName].RawValues))
+		}
+	}
+	for _, sampleName := range e.EndogenousControls.Names() {
+		endoTargetGene := e.EndogenousControls[sampleName]
+		for _, detectorName := range endoTargetGene.Detectors.Names() {
+			replicates = append(replicates, replicateQC(detectorName, sampleName, "ENDO", endoTargetGene.Detectors[detectorName]))
+		}
+	}
+
+	return replicates
+}
+
+//	replicateQC checks raw Ct values, values which are not numbers count as undetermined
+func replicateQC(detector, sample, task string, rawValues []string) ReplicateQC {
+	qc := ReplicateQC{Detector: detector, Sample: sample, Task: task, Replicates: len(rawValues), Flags: []string{}}
+
+	values := []float64{}
+	for _, value := range rawValues {
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			values = append(values, v)
+		} else {
+			qc.Undetermined++
+		}
+	}
+
+	if len(values) == 0 {
+		qc.Flags = append(qc.Flags, "no_amplification")
+		return qc
+	}
+
+	qc.Mean, qc.StdDev = meanAndStdDev(values)
+	if qc.Undetermined > 0 {
+		qc.Flags = append(qc.Flags, "undetermined")
+	}
+	if len(values) == 1 {
+		qc.Flags = append(qc.Flags, "single_replicate")
+	}
+	if qc.StdDev > qcMaxReplicateStdDev {
+		qc.Flags = append(qc.Flags, "high_replicate_spread")
+	}
+	if qc.Mean > qcLateCt {
+		qc.Flags = append(qc.Flags, "late_amplification")
+	}
+
+	return qc
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQualityControl(t *testing.T) {
+	md := AB7300{Mock: "mock"}
+	e, err := md.Compute(strings.NewReader(ab7300TestContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replicates := e.QualityControl()
+	if len(replicates) != 2 {
+		t.Fatalf("Target and endogenous control replicates should be checked, got %+v", replicates)
+	}
+
+	target := replicates[0]
+	if target.Detector != "IL8" || target.Task != "Target" || target.Replicates != 2 || target.Undetermined != 1 || !reflect.DeepEqual(target.Flags, []string{"undetermined", "single_replicate"}) {
+		t.Errorf("Target replicates are not checked, got %+v", target)
+	}
+
+	endo := replicates[1]
+	if endo.Detector != "GAPDH" || endo.Task != "ENDO" || endo.Mean != 20.1 {
+		t.Errorf("Endogenous control replicates are not checked, got %+v", endo)
+	}
+
+	qc := replicateQC("IL8", "a", "Target", []string{"36.0", "37.5"})
+	if !reflect.DeepEqual(qc.Flags, []string{"high_replicate_spread", "late_amplification"}) {
+		t.Errorf("Late and spread replicates should be flagged, got %+v", qc)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	//	maxLineLength bounds lines of raw-curve exports, longer lines fail the scan
+	//	with bufio.ErrTooLong
+	maxLineLength = 16 << 20
+)
+
+var (
+	utf8BOM    = []byte{0xef, 0xbb, 0xbf}
+	utf16LEBOM = []byte{0xff, 0xfe}
+	utf16BEBOM = []byte{0xfe, 0xff}
+)
+
+//	newLineScanner scans lines of instrument exports without their CRLF or LF line
+//	endings. UTF-8 and UTF-16 content with a byte order mark is decoded to UTF-8.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(decodeBOM(r))
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	return scanner
+}
+
+//	decodeBOM strips a UTF-8 byte order mark and transcodes UTF-16 to UTF-8
+func decodeBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	bom, _ := br.Peek(3)
+
+	switch {
+	case bytes.HasPrefix(bom, utf8BOM):
+		br.Discard(len(utf8BOM))
+	case bytes.HasPrefix(bom, utf16LEBOM):
+		br.Discard(len(utf16LEBOM))
+		return &utf16Reader{r: br, order: binary.LittleEndian}
+	case bytes.HasPrefix(bom, utf16BEBOM):
+		br.Discard(len(utf16BEBOM))
+		return &utf16Reader{r: br, order: binary.BigEndian}
+	}
+
+	return br
+}
+
+//	hasUTF16BOM reports content which has to be decoded before it is text
+func hasUTF16BOM(content []byte) bool {
+	return bytes.HasPrefix(content, utf16LEBOM) || bytes.HasPrefix(content, utf16BEBOM)
+}
+
+//	utf16Reader transcodes UTF-16 to UTF-8, unpaired surrogates become U+FFFD
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	out   []byte
+	err   error
+}
+
+func (ur *utf16Reader) Read(p []byte) (int, error) {
+	for len(ur.out) < len(p) && ur.err == nil {
+		var r rune
+		if r, ur.err = ur.readUnit(); ur.err != nil {
+			break
+		}
+
+		switch {
+		case r >= 0xd800 && r < 0xdc00:
+			r = ur.readLowSurrogate(r)
+		case utf16.IsSurrogate(r):
+			r = unicode.ReplacementChar
+		}
+		ur.out = utf8.AppendRune(ur.out, r)
+	}
+
+	if len(ur.out) == 0 {
+		return 0, ur.err
+	}
+
+	n := copy(p, ur.out)
+	ur.out = ur.out[n:]
+
+	return n, nil
+}
+
+//	readLowSurrogate pairs the high surrogate with the following unit when it is a low
+//	surrogate, any other unit is left for the next read and the high surrogate becomes
+//	U+FFFD
+func (ur *utf16Reader) readLowSurrogate(high rune) rune {
+	unit, err := ur.r.Peek(2)
+	if err != nil {
+		return unicode.ReplacementChar
+	}
+
+	low := rune(ur.order.Uint16(unit))
+	if low < 0xdc00 || low > 0xdfff {
+		return unicode.ReplacementChar
+	}
+	ur.r.Discard(2)
+
+	return utf16.DecodeRune(high, low)
+}
+
+func (ur *utf16Reader) readUnit() (rune, error) {
+	var unit [2]byte
+	if _, err := io.ReadFull(ur.r, unit[:]); err != nil {
+		return 0, err
+	}
+
+	return rune(ur.order.Uint16(unit[:])), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUTF16Reader(t *testing.T) {
+	for name, content := range map[string][]byte{
+		"little endian": {0xff, 0xfe, 'a', 0, 0xe9, 0, 0x3d, 0xd8, 0x00, 0xde, '\n', 0},
+		"big endian":    {0xfe, 0xff, 0, 'a', 0, 0xe9, 0xd8, 0x3d, 0xde, 0x00, 0, '\n'},
+	} {
+		decoded, err := io.ReadAll(decodeBOM(bytes.NewReader(content)))
+		if err != nil || string(decoded) != "aé😀\n" {
+			t.Errorf("%s: UTF-16 should decode to 'aé😀', got '%s' %v", name, decoded, err)
+		}
+	}
+}
+
+func TestUTF16ReaderUnpairedSurrogates(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		content  []byte
+		expected string
+	}{
+		"high before text":     {[]byte{0xff, 0xfe, 0x3d, 0xd8, 'a', 0, '\n', 0}, "\ufffda\n"},
+		"high before high":     {[]byte{0xff, 0xfe, 0x3d, 0xd8, 0x3d, 0xd8, 0x00, 0xde}, "\ufffd😀"},
+		"low alone":            {[]byte{0xff, 0xfe, 0x00, 0xde, 'a', 0}, "\ufffda"},
+		"low before high":      {[]byte{0xfe, 0xff, 0xde, 0x00, 0xd8, 0x3d, 0xde, 0x00}, "\ufffd😀"},
+		"high at end":          {[]byte{0xff, 0xfe, 'a', 0, 0x3d, 0xd8}, "a\ufffd"},
+		"high before odd byte": {[]byte{0xff, 0xfe, 0x3d, 0xd8, 'a'}, "\ufffd"},
+	} {
+		decoded, _ := io.ReadAll(decodeBOM(bytes.NewReader(testCase.content)))
+		if string(decoded) != testCase.expected {
+			t.Errorf("%s: UTF-16 should decode to %q, got %q", name, testCase.expected, decoded)
+		}
+	}
+}
+
+func TestLineScannerLongLines(t *testing.T) {
+	longLine := strings.Repeat("x", 1<<20)
+	scanner := newLineScanner(strings.NewReader("first\r\n" + longLine + "\r\nlast"))
+
+	lines := []string{}
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if scanner.Err() != nil || len(lines) != 3 || lines[0] != "first" || lines[1] != longLine || lines[2] != "last" {
+		t.Errorf("Scanner should return 3 lines without CR, got %d lines and error %v", len(lines), scanner.Err())
+	}
+
+	scanner = newLineScanner(strings.NewReader(strings.Repeat("x", maxLineLength+1)))
+	for scanner.Scan() {
+	}
+	if scanner.Err() != bufio.ErrTooLong {
+		t.Errorf("Scanner should fail on lines over %d bytes, got %v", maxLineLength, scanner.Err())
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	anonymousTier = "anonymous"
+	tokenTier     = "token"
+
+	//	unlimitedLimit lifts a limit of a consumer token, the upload size stays capped
+	//	by the server max upload size
+	unlimitedLimit = -1
+)
+
+//	TokenLimits are the limits of a tier, zero values of a consumer token fall back
+//	to the token tier defaults, zero values of a tier and unlimitedLimit mean unlimited.
+//	Requests are limited by a token bucket of RequestsBurst refilled with RequestsPerHour.
+type TokenLimits struct {
+	RequestsPerHour, RequestsBurst, UploadsPerDay, MaxExperiments int
+	MaxUploadSize                                                 int64
+}
+
+var (
+	//	anonymousLimits apply per ip address to requests without a valid consumer token
+	anonymousLimits = TokenLimits{RequestsPerHour: 50, RequestsBurst: 10, UploadsPerDay: 20, MaxUploadSize: 5 << 20}
+	tokenLimits     = TokenLimits{RequestsPerHour: 1000, RequestsBurst: 100, UploadsPerDay: 500, MaxExperiments: 1000, MaxUploadSize: 50 << 20}
+)
+
+//	ConsumerRateLimit is the request bucket state of the consumer, Limit is the bucket
+//	size and Current the number of requests taken from it
+type ConsumerRateLimit struct {
+	Tier                      string
+	Exceeded                  bool
+	Limit, Current, Remaining int
+	RetryAfter, ResetAt       time.Time
+	Limits                    TokenLimits
+	//	subject is the rate limited ip address or consumer token id
+	subject string
+	token   *ConsumerToken
+}
+
+//	withDefaults fills zero limits from the defaults, unlimitedLimit is kept
+func (tl TokenLimits) withDefaults(defaults TokenLimits) TokenLimits {
+	if tl.RequestsPerHour == 0 {
+		tl.RequestsPerHour = defaults.RequestsPerHour
+	}
+	if tl.RequestsBurst == 0 {
+		tl.RequestsBurst = defaults.RequestsBurst
+	}
+	if tl.UploadsPerDay == 0 {
+		tl.UploadsPerDay = defaults.UploadsPerDay
+	}
+	if tl.MaxExperiments == 0 {
+		tl.MaxExperiments = defaults.MaxExperiments
+	}
+	if tl.MaxUploadSize == 0 {
+		tl.MaxUploadSize = defaults.MaxUploadSize
+	}
+
+	return tl
+}
+
+//	consumerTier resolves the tier and limits of the request, requests with a missing
+//	or invalid consumer token fall into the anonymous tier limited per ip address
+func consumerTier(r *http.Request) (ConsumerRateLimit, error) {
+	ipAddress := clientIPAddress(r)
+	crl := ConsumerRateLimit{Tier: anonymousTier, Limits: anonymousLimits, subject: "ip:" + ipAddress}
+
+	consumerToken := getConsumerToken(r)
+	if len(consumerToken) == 0 {
+		return crl, nil
+	}
+
+	ct, err := GetConsumerToken(consumerToken)
+	if err == redis.ErrNil {
+		slog.InfoContext(r.Context(), "consumer token is not valid, using anonymous tier", "component", "ratelimit", "ip_address", ipAddress)
+		return crl, nil
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting consumer token failed", "component", "ratelimit", "ip_address", ipAddress, "error", err)
+		return ConsumerRateLimit{}, err
+	}
+
+	return ConsumerRateLimit{Tier: tokenTier, Limits: ct.Limits.withDefaults(tokenLimits), subject: "token:" + ct.TokenId, token: &ct}, nil
+}
+
+//	takeRateLimit takes cost requests from the token bucket of the consumer tier, cost
+//	0 only reads the bucket and reports it exceeded when no request is left
+func takeRateLimit(r *http.Request, cost int) (ConsumerRateLimit, error) {
+	crl, err := consumerTier(r)
+	if err != nil {
+		return crl, err
+	}
+
+	rate := Rate{Burst: crl.Limits.RequestsBurst, PerHour: crl.Limits.RequestsPerHour}
+	if rate.Burst <= 0 || rate.PerHour == unlimitedLimit {
+		crl.Limit, crl.Remaining = -1, -1
+		return crl, nil
+	}
+
+	res, err := rateLimiter.Take(crl.subject, rate, cost)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "taking request failed", "component", "ratelimit", "subject", crl.subject, "error", err)
+		return ConsumerRateLimit{}, err
+	}
+
+	timeNow := time.Now()
+	crl.Limit, crl.Remaining, crl.Current = rate.Burst, res.Remaining, rate.Burst-res.Remaining
+	crl.RetryAfter, crl.ResetAt = timeNow.Add(res.RetryAfter), timeNow.Add(res.ResetAfter)
+	if cost == 0 {
+		crl.Exceeded = res.Remaining < 1
+	} else if !res.Allowed {
+		slog.InfoContext(r.Context(), "rate limit exceeded", "component", "ratelimit", "subject", crl.subject, "tier", crl.Tier)
+		crl.Exceeded = true
+	}
+
+	return crl, nil
+}
+
+//	checkUploadQuota checks the number of retained experiments and reserves one of the
+//	daily uploads, it responds with 403 or 429 when a quota is exceeded. The reserved
+//	upload is given back by releaseUpload when the computation fails, reservedAt is
+//	zero when uploads are unlimited.
+func checkUploadQuota(w http.ResponseWriter, r *http.Request, crl ConsumerRateLimit) (reservedAt time.Time, ok bool) {
+	timeNow := time.Now()
+	if crl.token != nil && crl.Limits.MaxExperiments > 0 {
+		expIds, err := GetOwnerExperimentIds(crl.token.TokenId, time.Unix(0, 0), timeNow.Add(time.Hour))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "getting experiments failed", "component", "ratelimit", "subject", crl.subject, "error", err)
+			writeProblem(w, r, http.StatusInternalServerError, "internal_error", "getting experiments failed")
+			return reservedAt, false
+		}
+
+		if len(expIds) >= crl.Limits.MaxExperiments {
+			slog.InfoContext(r.Context(), "retained experiments limit reached", "component", "ratelimit", "subject", crl.subject, "experiments", len(expIds), "max_experiments", crl.Limits.MaxExperiments)
+			rateLimitRejectionsTotal.Inc(crl.Tier, "experiments")
+			writeProblem(w, r, http.StatusForbidden, "max_experiments_reached", fmt.Sprintf("retained experiments limit %d reached", crl.Limits.MaxExperiments))
+			return reservedAt, false
+		}
+	}
+
+	if crl.Limits.UploadsPerDay <= 0 {
+		return reservedAt, true
+	}
+
+	reserved, err := ReserveUpload(crl.subject, crl.Limits.UploadsPerDay, timeNow)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "reserving upload failed", "component", "ratelimit", "subject", crl.subject, "error", err)
+		writeProblem(w, r, http.StatusInternalServerError, "internal_error", "reserving upload failed")
+		return reservedAt, false
+	}
+
+	if !reserved {
+		slog.InfoContext(r.Context(), "daily uploads exceeded", "component", "ratelimit", "subject", crl.subject, "uploads_per_day", crl.Limits.UploadsPerDay)
+		rateLimitRejectionsTotal.Inc(crl.Tier, "uploads")
+		tomorrow := time.Date(timeNow.Year(), timeNow.Month(), timeNow.Day()+1, 0, 0, 0, 0, timeNow.Location())
+		writeTooManyRequests(w, r, RateLimitProblem{
+			Problem:    newProblem(http.StatusTooManyRequests, "upload_quota_exceeded", fmt.Sprintf("%s tier allows %d uploads per day", crl.Tier, crl.Limits.UploadsPerDay), nil),
+			Tier:       crl.Tier,
+			Limit:      crl.Limits.UploadsPerDay,
+			RetryAfter: tomorrow,
+		})
+		return reservedAt, false
+	}
+
+	return timeNow, true
+}
+
+//	releaseUpload gives back the upload reserved by checkUploadQuota, uploads which
+//	fail do not use up the quota
+func releaseUpload(ctx context.Context, crl ConsumerRateLimit, reservedAt time.Time) {
+	if reservedAt.IsZero() {
+		return
+	}
+
+	if err := ReleaseUpload(crl.subject, reservedAt); err != nil {
+		slog.ErrorContext(ctx, "releasing upload failed", "component", "ratelimit", "subject", crl.subject, "error", err)
+	}
+}
+
+//	owner returns the consumer token id experiments of the request belong to, it is
+//	empty for anonymous requests
+func (crl ConsumerRateLimit) owner() string {
+	if crl.token == nil {
+		return ""
+	}
+
+	return crl.token.TokenId
+}
+
+//	RateLimitProblem is the problem document of 429 responses, it extends Problem with
+//	the exceeded limit of the tier
+type RateLimitProblem struct {
+	Problem
+	Tier       string    `json:"tier"`
+	Limit      int       `json:"limit"`
+	RetryAfter time.Time `json:"retryAfter"`
+}
+
+//	writeRateLimitHeaders sets the RateLimit-Limit, RateLimit-Remaining and
+//	RateLimit-Reset (seconds until the bucket is full) headers
+func writeRateLimitHeaders(w http.ResponseWriter, crl ConsumerRateLimit) {
+	if crl.Limit < 0 {
+		return
+	}
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(crl.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(crl.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(secondsUntil(crl.ResetAt)))
+}
+
+//	writeRateLimitExceeded responds with 429 explaining the request limit of the tier
+func writeRateLimitExceeded(w http.ResponseWriter, r *http.Request, crl ConsumerRateLimit) {
+	writeTooManyRequests(w, r, RateLimitProblem{
+		Problem:    newProblem(http.StatusTooManyRequests, "rate_limit_exceeded", fmt.Sprintf("%s tier allows %d requests at once and %d requests per hour", crl.Tier, crl.Limits.RequestsBurst, crl.Limits.RequestsPerHour), nil),
+		Tier:       crl.Tier,
+		Limit:      crl.Limit,
+		RetryAfter: crl.RetryAfter,
+	})
+}
+
+//	writeTooManyRequests responds with the 429 problem, Retry-After is set in seconds and
+//	the RateLimit headers are left as set by withRateLimit
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, problem RateLimitProblem) {
+	problem.Instance, problem.RequestId = r.URL.Path, requestId(r)
+
+	w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(problem.RetryAfter)))
+	writeProblemContent(w, r, http.StatusTooManyRequests, problem)
+}
+
+//	secondsUntil rounds up, so clients never retry too early
+func secondsUntil(t time.Time) int {
+	seconds := int(math.Ceil(time.Until(t).Seconds()))
+	if seconds < 0 {
+		return 0
+	}
+
+	return seconds
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+//	Rate is a token bucket holding up to Burst requests and refilled with PerHour
+//	requests spread evenly over the hour
+type Rate struct {
+	Burst, PerHour int
+}
+
+//	RateLimitResult is the state of the bucket after a request was taken
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	//	RetryAfter is the time until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+	//	ResetAfter is the time until the bucket is full again
+	ResetAfter time.Duration
+}
+
+type RateLimiter interface {
+	//	Take removes cost requests from the bucket of the key, cost 0 only reads the state
+	Take(key string, rate Rate, cost int) (RateLimitResult, error)
+}
+
+var (
+	rateLimiter RateLimiter
+)
+
+//	newRateLimiter returns the redis limiter shared by all api instances or the
+//	in-process memory limiter
+func newRateLimiter(backend string) (RateLimiter, error) {
+	switch backend {
+	case "redis":
+		return &redisRateLimiter{}, nil
+	case "memory":
+		return newMemoryRateLimiter(), nil
+	}
+
+	return nil, fmt.Errorf("rate limit backend '%s' is not valid", backend)
+}
+
+//	perSecond returns the refill rate of the bucket
+func (rate Rate) perSecond() float64 {
+	return float64(rate.PerHour) / 3600
+}
+
+//	refill returns the tokens in the bucket after elapsed seconds, it is mirrored by
+//	the redis lua script
+func (rate Rate) refill(tokens, elapsed float64) float64 {
+	return math.Min(float64(rate.Burst), tokens+math.Max(0, elapsed)*rate.perSecond())
+}
+
+//	result computes remaining requests and refill times from the tokens left in the bucket
+func (rate Rate) result(allowed bool, tokens float64, cost int) RateLimitResult {
+	res := RateLimitResult{Allowed: allowed, Remaining: int(math.Floor(tokens))}
+	if rate.PerHour <= 0 {
+		return res
+	}
+
+	if !allowed {
+		res.RetryAfter = secondsToDuration((float64(cost) - tokens) / rate.perSecond())
+	} else if cost == 0 && tokens < 1 {
+		res.RetryAfter = secondsToDuration((1 - tokens) / rate.perSecond())
+	}
+	res.ResetAfter = secondsToDuration((float64(rate.Burst) - tokens) / rate.perSecond())
+
+	return res
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+//	bucket keeps the rate it was last taken with, so sweeps judge every bucket by its
+//	own tier
+type bucket struct {
+	tokens float64
+	at     time.Time
+	rate   Rate
+}
+
+//	memoryRateLimiter keeps buckets in process memory, it is meant for running a
+//	single api instance
+type memoryRateLimiter struct {
+	sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+const (
+	memoryRateLimiterSweepSize = 10000
+)
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (ml *memoryRateLimiter) Take(key string, rate Rate, cost int) (RateLimitResult, error) {
+	ml.Lock()
+	defer ml.Unlock()
+
+	timeNow := ml.now()
+	b, found := ml.buckets[key]
+	if !found {
+		if len(ml.buckets) >= memoryRateLimiterSweepSize {
+			ml.sweep(timeNow)
+		}
+		b = &bucket{tokens: float64(rate.Burst), at: timeNow}
+		ml.buckets[key] = b
+	}
+
+	b.tokens = rate.refill(b.tokens, timeNow.Sub(b.at).Seconds())
+	b.at, b.rate = timeNow, rate
+
+	allowed := b.tokens >= float64(cost)
+	if allowed {
+		b.tokens -= float64(cost)
+	}
+
+	return rate.result(allowed, b.tokens, cost), nil
+}
+
+//	sweep drops buckets which are full again, they are equal to new buckets
+func (ml *memoryRateLimiter) sweep(timeNow time.Time) {
+	for key, b := range ml.buckets {
+		if b.rate.refill(b.tokens, timeNow.Sub(b.at).Seconds()) >= float64(b.rate.Burst) {
+			delete(ml.buckets, key)
+		}
+	}
+}
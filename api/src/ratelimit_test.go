@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenLimitsWithDefaults(t *testing.T) {
+	limits := TokenLimits{RequestsPerHour: 10}.withDefaults(tokenLimits)
+
+	if limits.RequestsPerHour != 10 {
+		t.Errorf("Token requests per hour %d should override the default!", limits.RequestsPerHour)
+	}
+	if limits.UploadsPerDay != tokenLimits.UploadsPerDay || limits.MaxUploadSize != tokenLimits.MaxUploadSize || limits.MaxExperiments != tokenLimits.MaxExperiments {
+		t.Errorf("Missing limits %+v should use the token tier defaults!", limits)
+	}
+
+	limits = TokenLimits{UploadsPerDay: unlimitedLimit, MaxUploadSize: unlimitedLimit}.withDefaults(tokenLimits)
+	if limits.UploadsPerDay != unlimitedLimit || limits.MaxUploadSize != unlimitedLimit {
+		t.Errorf("Unlimited limits %+v should not use the defaults!", limits)
+	}
+
+	serverMaxUploadSize = 64 << 20
+	defer func() { serverMaxUploadSize = 0 }()
+	if size := uploadSizeLimit(ConsumerRateLimit{Limits: limits}); size != serverMaxUploadSize {
+		t.Errorf("Unlimited upload size should be capped by the server, got %d!", size)
+	}
+}
+
+func TestUploadQuotaCountsComputedUploads(t *testing.T) {
+	storage, restore := useFakeRedis()
+	defer restore()
+
+	upload := func(content string, limits TokenLimits) int {
+		crl := ConsumerRateLimit{Tier: anonymousTier, Limits: limits, subject: "ip:192.0.2.1"}
+		r := httptest.NewRequest("POST", "/v1/qpcr/ab7300?mock=mock", strings.NewReader(content))
+		w := httptest.NewRecorder()
+		qpcrHandler(w, r.WithContext(context.WithValue(r.Context(), rateLimitContextKey, crl)))
+		return w.Code
+	}
+
+	limits := TokenLimits{UploadsPerDay: 1, MaxUploadSize: 1 << 20}
+	for _, content := range []string{"Applied Biosystems 7300 Real-Time PCR System\n", strings.Repeat("x", 2<<20)} {
+		if status := upload(content, limits); status != http.StatusBadRequest && status != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Upload should fail, got %d!", status)
+		}
+	}
+	if uploads, _ := GetUploadCounter("ip:192.0.2.1", time.Now()); uploads != 0 {
+		t.Errorf("Failed uploads should not be counted, got %d!", uploads)
+	}
+
+	if status := upload(ab7300TestContent, limits); status != http.StatusCreated {
+		t.Fatalf("Upload within the quota should be computed, got %d!", status)
+	}
+	if status := upload(ab7300TestContent, limits); status != http.StatusTooManyRequests {
+		t.Errorf("Upload over the quota should be 429, got %d!", status)
+	}
+
+	limits.UploadsPerDay = unlimitedLimit
+	if status := upload(ab7300TestContent, limits); status != http.StatusOK {
+		t.Errorf("Unlimited uploads should be computed, got %d!", status)
+	}
+	if len(storage.values) == 0 {
+		t.Error("Computed upload should be stored!")
+	}
+}
+
+func TestReserveUploadIsAtomic(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	timeNow := time.Now()
+	var reserved sync.WaitGroup
+	var mu sync.Mutex
+	count := 0
+	for i := 0; i < 10; i++ {
+		reserved.Add(1)
+		go func() {
+			defer reserved.Done()
+			if ok, err := ReserveUpload("ip:192.0.2.1", 3, timeNow); err == nil && ok {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	reserved.Wait()
+
+	if uploads, _ := GetUploadCounter("ip:192.0.2.1", timeNow); count != 3 || uploads != 3 {
+		t.Errorf("Concurrent uploads should reserve the limit of 3, got %d reserved and counter %d!", count, uploads)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := ReleaseUpload("ip:192.0.2.1", timeNow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if uploads, _ := GetUploadCounter("ip:192.0.2.1", timeNow); uploads != 0 {
+		t.Errorf("Released uploads should not drop the counter below zero, got %d!", uploads)
+	}
+}
+
+func TestMemoryRateLimiterRefill(t *testing.T) {
+	timeNow := time.Unix(1356998400, 0)
+	ml := newMemoryRateLimiter()
+	ml.now = func() time.Time { return timeNow }
+	rate := Rate{Burst: 2, PerHour: 60}
+
+	for i := 0; i < 2; i++ {
+		if res, _ := ml.Take("ip:127.0.0.1", rate, 1); !res.Allowed {
+			t.Fatalf("Request %d within the burst was not allowed!", i+1)
+		}
+	}
+
+	res, _ := ml.Take("ip:127.0.0.1", rate, 1)
+	if res.Allowed || res.RetryAfter != time.Minute {
+		t.Fatalf("Request over the burst should wait a minute, got %+v!", res)
+	}
+
+	timeNow = timeNow.Add(time.Minute)
+	if res, _ = ml.Take("ip:127.0.0.1", rate, 1); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("Request after refill was not allowed, got %+v!", res)
+	}
+	if res.ResetAfter != 2*time.Minute {
+		t.Errorf("Bucket should be full in two minutes, got %s!", res.ResetAfter)
+	}
+
+	if res, _ = ml.Take("ip:127.0.0.2", rate, 1); !res.Allowed {
+		t.Error("Buckets of different keys are not independent!")
+	}
+}
+
+func TestMemoryRateLimiterSweepMixedTiers(t *testing.T) {
+	timeNow := time.Unix(1356998400, 0)
+	ml := newMemoryRateLimiter()
+	ml.now = func() time.Time { return timeNow }
+	anonymousRate := Rate{Burst: anonymousLimits.RequestsBurst, PerHour: anonymousLimits.RequestsPerHour}
+	tokenRate := Rate{Burst: tokenLimits.RequestsBurst, PerHour: tokenLimits.RequestsPerHour}
+
+	ml.Take("token:a", tokenRate, tokenRate.Burst/2)
+	ml.Take("ip:192.0.2.1", anonymousRate, anonymousRate.Burst)
+	for i := len(ml.buckets); i < memoryRateLimiterSweepSize; i++ {
+		ml.Take(fmt.Sprintf("ip:10.0.%d.%d", i/256, i%256), anonymousRate, 0)
+	}
+
+	timeNow = timeNow.Add(time.Second)
+	ml.Take("ip:192.0.2.2", anonymousRate, 1)
+	ml.Take("token:b", tokenRate, 1)
+	if len(ml.buckets) != 4 {
+		t.Errorf("Sweeps should drop only full buckets, %d buckets left!", len(ml.buckets))
+	}
+
+	if res, _ := ml.Take("token:a", tokenRate, 0); res.Remaining != tokenRate.Burst/2 {
+		t.Errorf("Partly drained token bucket should survive the sweep of an anonymous request, got %+v!", res)
+	}
+	if res, _ := ml.Take("ip:192.0.2.1", anonymousRate, 0); res.Remaining != 0 {
+		t.Errorf("Drained anonymous bucket should survive the sweep of a token request, got %+v!", res)
+	}
+}
+
+func TestRateLimitExceededResponse(t *testing.T) {
+	crl := ConsumerRateLimit{Tier: anonymousTier, Exceeded: true, Limit: 10, RetryAfter: time.Now().Add(90 * time.Second), ResetAt: time.Now().Add(time.Hour), Limits: anonymousLimits}
+	w := httptest.NewRecorder()
+
+	writeRateLimitHeaders(w, crl)
+	writeRateLimitExceeded(w, httptest.NewRequest("GET", "/v1/experiments", nil), crl)
+
+	if w.Code != 429 {
+		t.Errorf("Status %d is not 429!", w.Code)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "90" {
+		t.Errorf("Retry-After '%s' is not in seconds!", retryAfter)
+	}
+	if w.Header().Get("RateLimit-Limit") != "10" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Reset") != "3600" {
+		t.Errorf("RateLimit headers %+v are not valid!", w.Header())
+	}
+
+	if w.Header().Get("Content-Type") != problemContentType {
+		t.Errorf("Content-Type '%s' is not a problem document!", w.Header().Get("Content-Type"))
+	}
+	var problem RateLimitProblem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Code != "rate_limit_exceeded" || problem.Status != 429 || problem.Instance != "/v1/experiments" {
+		t.Errorf("Body '%s' is not a rate limit problem!", w.Body.String())
+	}
+	if problem.Tier != anonymousTier || problem.Limit != 10 || problem.RetryAfter.IsZero() {
+		t.Errorf("Rate limit problem %+v should explain the limit!", problem)
+	}
+}
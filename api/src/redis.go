@@ -2,11 +2,12 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"io"
 	"time"
 	"encoding/json"
 	"crypto/sha256"
+	"sort"
 	"github.com/garyburd/redigo/redis"
 )
 
@@ -17,23 +18,63 @@ var (
 const (
 	redisKeyPrefix = "qpcrbox"
 	expirimentExpiresTime = 7200 // in seconds
-	tokenExpiresTime = 3600 // in seconds
 )
 
-func SaveExperiment(e *Experiment) (string, error) {
+//	SaveExperiment stores the experiment under its content-addressed id together with
+//	its source and the id of the consumer token that uploaded it. When the same
+//	experiment is already stored, it is left untouched and created is false, the
+//	uploading token still becomes one of its owners. Metadata is stored per owner, so
+//	every token sees its own filename and upload time. ExpiresAt is the expiration of
+//	the stored experiment.
+func SaveExperiment(e *Experiment, source []byte, meta *ExperimentMeta, owner string) (expId string, created bool, expiresAt time.Time, err error) {
 	expJsonBytes, err := json.Marshal(e)
 	if err != nil {
-		log.Fatalf("Marshalling experiment to JSON failed! Error: %s\n", err)
+		return "", false, expiresAt, err
 	}
 
-	expJson := string(expJsonBytes)
-	expId := getExpId(expJson)
-	err = persist(expId, expJson)
+	expId = getExpId(e.Canonical())
+	created, ttl, err := storeExperiment(expId, string(expJsonBytes), source)
 	if err != nil {
-		return "", err
+		return "", false, expiresAt, err
 	}
 
-	return expId, nil
+	meta.ExperimentId = expId
+	meta.ExpiresAt = meta.UploadedAt.Add(ttl)
+	if err = saveExperimentMeta(meta, owner, ttl); err != nil {
+		return "", false, expiresAt, err
+	}
+
+	if len(owner) > 0 {
+		if err = addExperimentOwner(expId, owner, ttl); err != nil {
+			return "", false, expiresAt, err
+		}
+		if err = addOwnerExperiment(owner, expId, meta.UploadedAt); err != nil {
+			return "", false, expiresAt, err
+		}
+	}
+
+	return expId, created, meta.ExpiresAt, nil
+}
+
+//	storeExperiment persists a new experiment with its source and returns its time to
+//	live, the time to live of an already stored experiment is looked up. An experiment
+//	which expires in between is stored again.
+func storeExperiment(expId, value string, source []byte) (bool, time.Duration, error) {
+	for attempt := 0; ; attempt++ {
+		created, err := persist(expId, value)
+		if err != nil {
+			return false, 0, err
+		}
+
+		if created {
+			return true, expirimentExpiresTime * time.Second, persistExperimentData(expId, "expsrc", source)
+		}
+
+		ttl, err := GetExperimentTTL(expId)
+		if err != redis.ErrNil || attempt > 0 {
+			return false, ttl, err
+		}
+	}
 }
 
 func GetExperiment(expId string) ([]byte, error) {
@@ -50,37 +91,528 @@ func GetExperiment(expId string) ([]byte, error) {
 	return expBytes, nil
 }
 
-func GetRateLimitCounter(ipAddress string, timeNow time.Time) (int, error) {
+//	GetExperimentMeta returns the metadata recorded when the owner uploaded the
+//	experiment, the empty owner returns the metadata of the last anonymous upload
+func GetExperimentMeta(expId, owner string) (ExperimentMeta, error) {
 	redisConn := redisPool.Get()
 	defer redisConn.Close()
 
-	var counter int
-	var err error
+	var meta ExperimentMeta
+	metaBytes, err := redis.Bytes(redisConn.Do("GET", experimentMetaKey(expId, owner)))
+	if err != nil {
+		return meta, err
+	}
+
+	err = json.Unmarshal(metaBytes, &meta)
+
+	return meta, err
+}
+
+//	GetExperimentSource returns the uploaded run file the experiment was computed from
+func GetExperimentSource(expId string) ([]byte, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:expsrc:%s", redisKeyPrefix, expId)
+
+	return redis.Bytes(redisConn.Do("GET", key))
+}
+
+//	GetOwnerExperimentIds returns ids of experiments uploaded by the owner between
+//	from and to, newest first. Ids of expired experiments are removed from the index.
+func GetOwnerExperimentIds(owner string, from, to time.Time) ([]string, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:experiments:%s", redisKeyPrefix, owner)
+	expired := time.Now().Add((-1) * expirimentExpiresTime * time.Second)
+	if _, err := redisConn.Do("ZREMRANGEBYSCORE", key, "-inf", fmt.Sprintf("(%d", expired.Unix())); err != nil {
+		return []string{}, err
+	}
+
+	return redis.Strings(redisConn.Do("ZREVRANGEBYSCORE", key, to.Unix(), from.Unix()))
+}
+
+//	IsExperimentOwner reports whether the consumer token uploaded the experiment,
+//	every token uploading the same content owns it
+func IsExperimentOwner(expId, owner string) (bool, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:expowners:%s", redisKeyPrefix, expId)
+
+	return redis.Bool(redisConn.Do("SISMEMBER", key, owner))
+}
+
+//	deleteExperimentScript removes the owner reference with the owner metadata and the
+//	experiment with its source and anonymous metadata once no owner is left, it returns
+//	whether the reference was removed and whether the experiment was deleted
+var deleteExperimentScript = redis.NewScript(6, `
+local removed = redis.call('SREM', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[2])
+local deleted = 0
+if removed == 1 then
+	redis.call('DEL', KEYS[5])
+	if redis.call('SCARD', KEYS[1]) == 0 then
+		redis.call('DEL', KEYS[3], KEYS[4], KEYS[6])
+		deleted = 1
+	end
+end
+return {removed, deleted}
+`)
+
+//	DeleteExperiment removes the reference of the owner to the experiment, the
+//	experiment is deleted with its last owner. Removed is false when the owner did
+//	not own the experiment, deleted is false while other owners are left.
+func DeleteExperiment(expId, owner string) (removed, deleted bool, err error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	keyOwners := fmt.Sprintf("%s:expowners:%s", redisKeyPrefix, expId)
+	keyOwnerExps := fmt.Sprintf("%s:experiments:%s", redisKeyPrefix, owner)
+	keyExp := fmt.Sprintf("%s:expid:%s", redisKeyPrefix, expId)
+	keySrc := fmt.Sprintf("%s:expsrc:%s", redisKeyPrefix, expId)
+	keyMeta := experimentMetaKey(expId, owner)
+	keyAnonymousMeta := experimentMetaKey(expId, "")
+
+	res, err := redis.Ints(deleteExperimentScript.Do(redisConn, keyOwners, keyOwnerExps, keyExp, keySrc, keyMeta, keyAnonymousMeta, owner, expId))
+	if err != nil {
+		return false, false, err
+	}
+	if len(res) != 2 {
+		return false, false, fmt.Errorf("delete script returned %d values", len(res))
+	}
+
+	return res[0] == 1, res[1] == 1, nil
+}
+
+//	GetExperimentTTL returns the remaining time to live of the experiment
+func GetExperimentTTL(expId string) (time.Duration, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:expid:%s", redisKeyPrefix, expId)
+	ttl, err := redis.Int(redisConn.Do("TTL", key))
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, redis.ErrNil
+	}
+
+	return time.Duration(ttl) * time.Second, nil
+}
+
+//	rateLimitScript is the token bucket of Rate.refill, it is atomic and uses the
+//	redis clock so all api instances share the same buckets
+var rateLimitScript = redis.NewScript(1, `
+if redis.replicate_commands then redis.replicate_commands() end
+local rate, burst, cost = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens, at = tonumber(bucket[1]) or burst, tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - at) * rate)
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(now))
+if rate > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+end
+return {allowed, tostring(tokens)}
+`)
+
+type redisRateLimiter struct{}
+
+func (rl *redisRateLimiter) Take(key string, rate Rate, cost int) (RateLimitResult, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	keyBucket := fmt.Sprintf("%s:ratelimit:%s", redisKeyPrefix, key)
+	res, err := redis.Values(rateLimitScript.Do(redisConn, keyBucket, rate.perSecond(), rate.Burst, cost))
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	var allowed int
+	var tokens float64
+	if _, err = redis.Scan(res, &allowed, &tokens); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	slog.Debug("rate limit bucket taken", "component", "redis", "bucket", keyBucket, "tokens", tokens)
+
+	return rate.result(allowed == 1, tokens, cost), nil
+}
+
+type redisJobStore struct{}
+
+func (js *redisJobStore) Save(job Job, ttl time.Duration) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	jobJsonBytes, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
 
-	keyCount := fmt.Sprintf("%s:ratelimit:%02d:%s", redisKeyPrefix, timeNow.Hour(), ipAddress)
-	if counter, err = redis.Int(redisConn.Do("INCR", keyCount)); err != nil {
-		return -1, err
+	key := fmt.Sprintf("%s:job:%s", redisKeyPrefix, job.JobId)
+	if _, err = redisConn.Do("SET", key, jobJsonBytes, "PX", ttl.Milliseconds()); err != nil {
+		return err
 	}
-	if _, err = redisConn.Do("EXPIRE", keyCount, tokenExpiresTime - (timeNow.Minute() * 60)); err != nil {
-		return -1, err
+
+	return nil
+}
+
+func (js *redisJobStore) Load(jobId string) (Job, bool, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:job:%s", redisKeyPrefix, jobId)
+	jobJsonBytes, err := redis.Bytes(redisConn.Do("GET", key))
+	if err == redis.ErrNil {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
 	}
 
-	log.Printf("[redis|ratelimit] keyCount '%s' has value '%d'\n", keyCount, counter)
+	var job Job
+	if err = json.Unmarshal(jobJsonBytes, &job); err != nil {
+		return Job{}, false, err
+	}
 
-	return counter, nil
+	return job, true, nil
 }
 
-func GetConsumerToken(token string) (bool, error) {
+//	reserveUploadScript increments the daily upload counter unless it reached the
+//	limit, the check and the increment are atomic so concurrent uploads cannot
+//	exceed the quota
+var reserveUploadScript = redis.NewScript(1, `
+local uploads = redis.call('INCR', KEYS[1])
+if uploads == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+if uploads > tonumber(ARGV[1]) then
+	redis.call('DECR', KEYS[1])
+	return 0
+end
+return 1
+`)
+
+//	releaseUploadScript gives back a reserved upload, the counter never drops below zero
+var releaseUploadScript = redis.NewScript(1, `
+if (tonumber(redis.call('GET', KEYS[1])) or 0) > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+func uploadCounterKey(subject string, day time.Time) string {
+	return fmt.Sprintf("%s:uploads:%s:%s", redisKeyPrefix, day.Format("20060102"), subject)
+}
+
+//	GetUploadCounter returns the daily upload counter of the subject
+func GetUploadCounter(subject string, timeNow time.Time) (int, error) {
 	redisConn := redisPool.Get()
 	defer redisConn.Close()
 
-	key := fmt.Sprintf("%s:token:%s", redisKeyPrefix, token)
-	res, err := redis.Int(redisConn.Do("EXIST", key))
+	counter, err := redis.Int(redisConn.Do("GET", uploadCounterKey(subject, timeNow)))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+
+	return counter, err
+}
+
+//	ReserveUpload counts an upload of the subject on the day of timeNow, it returns
+//	false without counting when the subject already reached the daily limit
+func ReserveUpload(subject string, limit int, timeNow time.Time) (bool, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	reserved, err := redis.Int(reserveUploadScript.Do(redisConn, uploadCounterKey(subject, timeNow), limit, 24*3600))
 	if err != nil {
 		return false, err
 	}
 
-	return res != 0, nil
+	return reserved == 1, nil
+}
+
+//	ReleaseUpload gives back an upload reserved on the day of reservedAt
+func ReleaseUpload(subject string, reservedAt time.Time) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	_, err := releaseUploadScript.Do(redisConn, uploadCounterKey(subject, reservedAt))
+
+	return err
+}
+
+type storedConsumerToken struct {
+	ConsumerToken
+	Hash string
+}
+
+//	GetConsumerToken looks the token up by its hash, redis.ErrNil is returned for
+//	unknown and expired tokens
+func GetConsumerToken(token string) (ConsumerToken, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:token:%s", redisKeyPrefix, hashConsumerToken(token))
+	tokenId, err := redis.String(redisConn.Do("GET", key))
+	if err != nil {
+		return ConsumerToken{}, err
+	}
+
+	ct, _, err := GetConsumerTokenById(tokenId)
+	if err != nil {
+		return ConsumerToken{}, err
+	}
+	if ct.Expired(time.Now()) {
+		return ConsumerToken{}, redis.ErrNil
+	}
+
+	return ct, nil
+}
+
+//	GetConsumerTokenById returns the token and its hash
+func GetConsumerTokenById(tokenId string) (ConsumerToken, string, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:tokenid:%s", redisKeyPrefix, tokenId)
+	tokenBytes, err := redis.Bytes(redisConn.Do("GET", key))
+	if err != nil {
+		return ConsumerToken{}, "", err
+	}
+
+	var sct storedConsumerToken
+	if err = json.Unmarshal(tokenBytes, &sct); err != nil {
+		return ConsumerToken{}, "", err
+	}
+
+	return sct.ConsumerToken, sct.Hash, nil
+}
+
+func GetConsumerTokenIds() ([]string, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:tokens", redisKeyPrefix)
+	tokenIds, err := redis.Strings(redisConn.Do("SMEMBERS", key))
+	if err != nil {
+		return []string{}, err
+	}
+	sort.Strings(tokenIds)
+
+	return tokenIds, nil
+}
+
+//	SaveConsumerToken stores the token under its hash, oldHash is removed when the
+//	token is rotated
+func SaveConsumerToken(ct *ConsumerToken, hash, oldHash string) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	tokenBytes, err := json.Marshal(storedConsumerToken{ConsumerToken: *ct, Hash: hash})
+	if err != nil {
+		return err
+	}
+
+	keyId := fmt.Sprintf("%s:tokenid:%s", redisKeyPrefix, ct.TokenId)
+	keyHash := fmt.Sprintf("%s:token:%s", redisKeyPrefix, hash)
+	keyTokens := fmt.Sprintf("%s:tokens", redisKeyPrefix)
+	if _, err = redisConn.Do("SET", keyId, tokenBytes); err != nil {
+		return err
+	}
+	if _, err = redisConn.Do("SET", keyHash, ct.TokenId); err != nil {
+		return err
+	}
+	if _, err = redisConn.Do("SADD", keyTokens, ct.TokenId); err != nil {
+		return err
+	}
+	if len(oldHash) > 0 && oldHash != hash {
+		if _, err = redisConn.Do("DEL", fmt.Sprintf("%s:token:%s", redisKeyPrefix, oldHash)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func DeleteConsumerToken(tokenId, hash string) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	keyId := fmt.Sprintf("%s:tokenid:%s", redisKeyPrefix, tokenId)
+	keyHash := fmt.Sprintf("%s:token:%s", redisKeyPrefix, hash)
+	keyTokens := fmt.Sprintf("%s:tokens", redisKeyPrefix)
+	if _, err := redisConn.Do("DEL", keyId, keyHash); err != nil {
+		return err
+	}
+	if _, err := redisConn.Do("SREM", keyTokens, tokenId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//	ExperimentExists reports whether the experiment is stored and not expired
+func ExperimentExists(expId string) (bool, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:expid:%s", redisKeyPrefix, expId)
+
+	return redis.Bool(redisConn.Do("EXISTS", key))
+}
+
+//	SaveProject stores the project and adds it to the owner projects
+func SaveProject(p *Project, owner string) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	projectJsonBytes, err := json.Marshal(Project{ProjectId: p.ProjectId, Name: p.Name, CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt})
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s:project:%s", redisKeyPrefix, p.ProjectId)
+	keyOwnerProjects := fmt.Sprintf("%s:projects:%s", redisKeyPrefix, owner)
+	if _, err = redisConn.Do("SET", key, projectJsonBytes); err != nil {
+		return err
+	}
+	if _, err = redisConn.Do("SADD", keyOwnerProjects, p.ProjectId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//	GetProject returns the project with its experiment ids in the order they were
+//	added, redis.ErrNil is returned when the owner has no such project. Experiments
+//	which expired are removed from the project.
+func GetProject(projectId, owner string) (Project, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	var p Project
+	keyOwnerProjects := fmt.Sprintf("%s:projects:%s", redisKeyPrefix, owner)
+	owned, err := redis.Bool(redisConn.Do("SISMEMBER", keyOwnerProjects, projectId))
+	if err != nil {
+		return p, err
+	}
+	if !owned {
+		return p, redis.ErrNil
+	}
+
+	key := fmt.Sprintf("%s:project:%s", redisKeyPrefix, projectId)
+	projectBytes, err := redis.Bytes(redisConn.Do("GET", key))
+	if err != nil {
+		return p, err
+	}
+	if err = json.Unmarshal(projectBytes, &p); err != nil {
+		return p, err
+	}
+
+	keyExps := fmt.Sprintf("%s:projectexps:%s", redisKeyPrefix, projectId)
+	expIds, err := redis.Strings(redisConn.Do("ZRANGE", keyExps, 0, -1))
+	if err != nil {
+		return p, err
+	}
+
+	p.ExperimentIds = []string{}
+	for _, expId := range expIds {
+		exists, err := redis.Bool(redisConn.Do("EXISTS", fmt.Sprintf("%s:expid:%s", redisKeyPrefix, expId)))
+		if err != nil {
+			return p, err
+		}
+		if !exists {
+			if _, err = redisConn.Do("ZREM", keyExps, expId); err != nil {
+				return p, err
+			}
+			continue
+		}
+		p.ExperimentIds = append(p.ExperimentIds, expId)
+	}
+
+	return p, nil
+}
+
+func GetOwnerProjectIds(owner string) ([]string, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:projects:%s", redisKeyPrefix, owner)
+	projectIds, err := redis.Strings(redisConn.Do("SMEMBERS", key))
+	if err != nil {
+		return []string{}, err
+	}
+	sort.Strings(projectIds)
+
+	return projectIds, nil
+}
+
+//	AddProjectExperiment adds the experiment to the project, adding it twice keeps the original position
+func AddProjectExperiment(projectId, expId string) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:projectexps:%s", redisKeyPrefix, projectId)
+	_, err := redisConn.Do("ZADD", key, "NX", time.Now().UnixNano(), expId)
+
+	return err
+}
+
+//	RemoveProjectExperiment returns false when the experiment was not part of the project
+func RemoveProjectExperiment(projectId, expId string) (bool, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:projectexps:%s", redisKeyPrefix, projectId)
+	res, err := redis.Int(redisConn.Do("ZREM", key, expId))
+
+	return res != 0, err
+}
+
+func DeleteProject(projectId, owner string) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:project:%s", redisKeyPrefix, projectId)
+	keyExps := fmt.Sprintf("%s:projectexps:%s", redisKeyPrefix, projectId)
+	keyOwnerProjects := fmt.Sprintf("%s:projects:%s", redisKeyPrefix, owner)
+	if _, err := redisConn.Do("DEL", key, keyExps); err != nil {
+		return err
+	}
+	if _, err := redisConn.Do("SREM", keyOwnerProjects, projectId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//	PingRedis returns the round trip time of PING
+func PingRedis(timeout time.Duration) (time.Duration, error) {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	timeStart := time.Now()
+	if _, err := redis.DoWithTimeout(redisConn, timeout, "PING"); err != nil {
+		return 0, err
+	}
+
+	return time.Since(timeStart), nil
+}
+
+//	hashConsumerToken returns the value stored instead of the consumer token itself
+func hashConsumerToken(token string) string {
+	return getExpId(token)
 }
 
 func getExpId(s string) string {
@@ -90,12 +622,44 @@ func getExpId(s string) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func persist(expId, value string) error {
+//	persist sets the experiment only if it does not exist yet (SET NX), so
+//	concurrent identical submissions are stored just once
+func persist(expId, value string) (bool, error) {
 	redisConn := redisPool.Get()
 	defer redisConn.Close()
 
 	key := fmt.Sprintf("%s:expid:%s", redisKeyPrefix, expId)
-	if _, err := redisConn.Do("SET", key, value); err != nil {
+	res, err := redisConn.Do("SET", key, value, "EX", expirimentExpiresTime, "NX")
+	if err != nil {
+		return false, err
+	}
+
+	return res != nil, nil
+}
+
+//	addExperimentOwner adds the consumer token to the owners of the experiment, the
+//	owners expire together with the experiment
+func addExperimentOwner(expId, owner string, ttl time.Duration) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:expowners:%s", redisKeyPrefix, expId)
+	if _, err := redisConn.Do("SADD", key, owner); err != nil {
+		return err
+	}
+	if _, err := redisConn.Do("PEXPIRE", key, ttl.Milliseconds()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func addOwnerExperiment(owner, expId string, uploadedAt time.Time) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:experiments:%s", redisKeyPrefix, owner)
+	if _, err := redisConn.Do("ZADD", key, uploadedAt.Unix(), expId); err != nil {
 		return err
 	}
 	if _, err := redisConn.Do("EXPIRE", key, expirimentExpiresTime); err != nil {
@@ -104,3 +668,42 @@ func persist(expId, value string) error {
 
 	return nil
 }
+
+//	experimentMetaKey is the metadata key of the owner, metadata of anonymous uploads
+//	is kept without an owner
+func experimentMetaKey(expId, owner string) string {
+	if len(owner) == 0 {
+		return fmt.Sprintf("%s:expmeta:%s", redisKeyPrefix, expId)
+	}
+
+	return fmt.Sprintf("%s:expmeta:%s:%s", redisKeyPrefix, expId, owner)
+}
+
+//	saveExperimentMeta stores the metadata of the owner until the experiment expires
+func saveExperimentMeta(meta *ExperimentMeta, owner string, ttl time.Duration) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	metaJsonBytes, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if _, err = redisConn.Do("SET", experimentMetaKey(meta.ExperimentId, owner), metaJsonBytes, "PX", ttl.Milliseconds()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func persistExperimentData(expId, kind string, value []byte) error {
+	redisConn := redisPool.Get()
+	defer redisConn.Close()
+
+	key := fmt.Sprintf("%s:%s:%s", redisKeyPrefix, kind, expId)
+	if _, err := redisConn.Do("SET", key, value, "EX", expirimentExpiresTime); err != nil {
+		return err
+	}
+
+	return nil
+}
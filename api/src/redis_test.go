@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//	fakeRedis is an in-memory redis supporting the string, set and sorted set commands
+//	of the storage functions, keys do not expire. Scripts are emulated in Go.
+type fakeRedis struct {
+	sync.Mutex
+	values map[string][]byte
+	sets   map[string]map[string]bool
+	zsets  map[string]map[string]float64
+}
+
+type fakeRedisConn struct {
+	r *fakeRedis
+}
+
+//	useFakeRedis points redisPool to a new fake redis until the returned function is called
+func useFakeRedis() (*fakeRedis, func()) {
+	r := &fakeRedis{values: make(map[string][]byte), sets: make(map[string]map[string]bool), zsets: make(map[string]map[string]float64)}
+	redisPool = &redis.Pool{Dial: func() (redis.Conn, error) { return fakeRedisConn{r}, nil }}
+
+	return r, func() { redisPool = nil }
+}
+
+func (c fakeRedisConn) Close() error { return nil }
+func (c fakeRedisConn) Err() error   { return nil }
+func (c fakeRedisConn) Send(string, ...interface{}) error {
+	return errors.New("fake redis does not pipeline")
+}
+func (c fakeRedisConn) Flush() error { return nil }
+func (c fakeRedisConn) Receive() (interface{}, error) {
+	return nil, errors.New("fake redis does not pipeline")
+}
+
+func (c fakeRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.r.Lock()
+	defer c.r.Unlock()
+
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = fmt.Sprint(arg)
+		if b, ok := arg.([]byte); ok {
+			keys[i] = string(b)
+		}
+	}
+
+	return c.r.do(cmd, keys)
+}
+
+func (r *fakeRedis) do(cmd string, keys []string) (interface{}, error) {
+	switch strings.ToUpper(cmd) {
+	case "":
+		return nil, nil
+	case "GET":
+		if value, found := r.values[keys[0]]; found {
+			return value, nil
+		}
+		return nil, nil
+	case "SET":
+		if _, found := r.values[keys[0]]; found && containsString(keys[2:], "NX") {
+			return nil, nil
+		}
+		r.values[keys[0]] = []byte(keys[1])
+		return "OK", nil
+	case "INCR":
+		counter, _ := strconv.Atoi(string(r.values[keys[0]]))
+		r.values[keys[0]] = []byte(strconv.Itoa(counter + 1))
+		return int64(counter + 1), nil
+	case "DEL":
+		deleted := int64(0)
+		for _, key := range keys {
+			if _, found := r.values[key]; found {
+				deleted++
+			}
+			if _, found := r.sets[key]; found {
+				deleted++
+			}
+			if _, found := r.zsets[key]; found {
+				deleted++
+			}
+			delete(r.values, key)
+			delete(r.sets, key)
+			delete(r.zsets, key)
+		}
+		return deleted, nil
+	case "EXISTS":
+		_, value := r.values[keys[0]]
+		_, set := r.sets[keys[0]]
+		_, zset := r.zsets[keys[0]]
+		return boolReply(value || set || zset), nil
+	case "EXPIRE", "PEXPIRE":
+		return int64(1), nil
+	case "TTL":
+		if _, found := r.values[keys[0]]; found {
+			return int64(expirimentExpiresTime), nil
+		}
+		return int64(-2), nil
+	case "SADD":
+		if r.sets[keys[0]] == nil {
+			r.sets[keys[0]] = make(map[string]bool)
+		}
+		added := int64(0)
+		for _, member := range keys[1:] {
+			if !r.sets[keys[0]][member] {
+				added++
+			}
+			r.sets[keys[0]][member] = true
+		}
+		return added, nil
+	case "SREM":
+		removed := int64(0)
+		for _, member := range keys[1:] {
+			if r.sets[keys[0]][member] {
+				removed++
+			}
+			delete(r.sets[keys[0]], member)
+		}
+		if len(r.sets[keys[0]]) == 0 {
+			delete(r.sets, keys[0])
+		}
+		return removed, nil
+	case "SISMEMBER":
+		return boolReply(r.sets[keys[0]][keys[1]]), nil
+	case "SMEMBERS":
+		members := []interface{}{}
+		for member := range r.sets[keys[0]] {
+			members = append(members, []byte(member))
+		}
+		return members, nil
+	case "ZADD":
+		if r.zsets[keys[0]] == nil {
+			r.zsets[keys[0]] = make(map[string]float64)
+		}
+		nx, pairs := keys[1] == "NX", keys[1:]
+		if nx {
+			pairs = keys[2:]
+		}
+		added := int64(0)
+		for i := 0; i+1 < len(pairs); i += 2 {
+			score, _ := strconv.ParseFloat(pairs[i], 64)
+			if _, found := r.zsets[keys[0]][pairs[i+1]]; found && nx {
+				continue
+			} else if !found {
+				added++
+			}
+			r.zsets[keys[0]][pairs[i+1]] = score
+		}
+		return added, nil
+	case "ZREM":
+		removed := int64(0)
+		for _, member := range keys[1:] {
+			if _, found := r.zsets[keys[0]][member]; found {
+				removed++
+			}
+			delete(r.zsets[keys[0]], member)
+		}
+		if len(r.zsets[keys[0]]) == 0 {
+			delete(r.zsets, keys[0])
+		}
+		return removed, nil
+	case "ZRANGE":
+		return r.zrange(keys[0], math.Inf(-1), math.Inf(1), false), nil
+	case "ZREVRANGEBYSCORE":
+		return r.zrange(keys[0], parseScore(keys[2]), parseScore(keys[1]), true), nil
+	case "ZREMRANGEBYSCORE":
+		removed := int64(0)
+		for _, member := range r.zrange(keys[0], parseScore(keys[1]), parseScore(keys[2]), false) {
+			delete(r.zsets[keys[0]], string(member.([]byte)))
+			removed++
+		}
+		return removed, nil
+	case "SCARD":
+		return int64(len(r.sets[keys[0]])), nil
+	case "EVALSHA":
+		return nil, redis.Error("NOSCRIPT No matching script")
+	case "EVAL":
+		n, _ := strconv.Atoi(keys[1])
+		return r.eval(keys[0], keys[2:2+n], keys[2+n:])
+	}
+
+	return nil, fmt.Errorf("fake redis does not support %s", cmd)
+}
+
+//	eval runs the Go version of the scripts of the storage functions
+func (r *fakeRedis) eval(script string, keys, argv []string) (interface{}, error) {
+	switch {
+	case strings.Contains(script, "SCARD"):
+		removed, _ := r.do("SREM", []string{keys[0], argv[0]})
+		r.do("ZREM", []string{keys[1], argv[1]})
+		deleted := int64(0)
+		if removed.(int64) == 1 {
+			r.do("DEL", []string{keys[4]})
+			if len(r.sets[keys[0]]) == 0 {
+				r.do("DEL", []string{keys[2], keys[3], keys[5]})
+				deleted = 1
+			}
+		}
+		return []interface{}{removed, deleted}, nil
+	case strings.Contains(script, "INCR"):
+		uploads, _ := r.do("INCR", keys[:1])
+		limit, _ := strconv.Atoi(argv[0])
+		if uploads.(int64) > int64(limit) {
+			r.values[keys[0]] = []byte(strconv.FormatInt(uploads.(int64)-1, 10))
+			return int64(0), nil
+		}
+		return int64(1), nil
+	case strings.Contains(script, "DECR"):
+		uploads, _ := strconv.Atoi(string(r.values[keys[0]]))
+		if uploads <= 0 {
+			return int64(0), nil
+		}
+		r.values[keys[0]] = []byte(strconv.Itoa(uploads - 1))
+		return int64(uploads - 1), nil
+	}
+
+	return nil, fmt.Errorf("fake redis does not support script %q", script)
+}
+
+//	zrange returns the members scored between min and max, all of them for ZRANGE 0 -1
+func (r *fakeRedis) zrange(key string, min, max float64, reverse bool) []interface{} {
+	members := []string{}
+	for member, score := range r.zsets[key] {
+		if score >= min && score <= max {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if r.zsets[key][members[i]] == r.zsets[key][members[j]] {
+			return members[i] < members[j] != reverse
+		}
+		return r.zsets[key][members[i]] < r.zsets[key][members[j]] != reverse
+	})
+
+	reply := []interface{}{}
+	for _, member := range members {
+		reply = append(reply, []byte(member))
+	}
+
+	return reply
+}
+
+//	parseScore parses score bounds, an exclusive bound "(x" is treated as inclusive
+func parseScore(value string) float64 {
+	switch value {
+	case "-inf":
+		return math.Inf(-1)
+	case "+inf":
+		return math.Inf(1)
+	}
+	score, _ := strconv.ParseFloat(strings.TrimPrefix(value, "("), 64)
+
+	return score
+}
+
+func boolReply(b bool) int64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
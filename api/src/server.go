@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//	ServerConfig are the timeouts and TLS files of the http server, uploads have to
+//	be read within ReadTimeout and exports written within WriteTimeout. On shutdown
+//	readiness fails for ShutdownDrainDelay before connections stop being accepted, so
+//	load balancers stop routing to the instance first.
+type ServerConfig struct {
+	Port                                         int
+	ReadHeaderTimeout, ReadTimeout, WriteTimeout time.Duration
+	IdleTimeout, ShutdownTimeout                 time.Duration
+	ShutdownDrainDelay                           time.Duration
+	TLSCertFile, TLSKeyFile                      string
+}
+
+var (
+	//	shuttingDown fails the readiness probe while in-flight requests are drained
+	shuttingDown atomic.Bool
+)
+
+func (config ServerConfig) validate() error {
+	if (len(config.TLSCertFile) > 0) != (len(config.TLSKeyFile) > 0) {
+		return errors.New("tls-cert and tls-key must be set together")
+	}
+	for _, timeout := range []time.Duration{config.ReadHeaderTimeout, config.ReadTimeout, config.WriteTimeout, config.IdleTimeout, config.ShutdownTimeout, config.ShutdownDrainDelay} {
+		if timeout < 0 {
+			return errors.New("server timeouts can not be negative")
+		}
+	}
+
+	return nil
+}
+
+func newServer(config ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(config.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+//	serve runs the server until SIGINT or SIGTERM and shuts it down gracefully
+func serve(config ServerConfig, srv *http.Server) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		if len(config.TLSCertFile) > 0 {
+			served <- srv.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			served <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		stop()
+	}
+
+	slog.Info("shutting down", "component", "server", "drain_delay", config.ShutdownDrainDelay, "timeout", config.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownDrainDelay+config.ShutdownTimeout)
+	defer cancel()
+
+	return shutdown(shutdownCtx, config.ShutdownDrainDelay, srv, jobQueue, webhookSender, redisPool)
+}
+
+//	shutdown fails readiness for the drain delay while still serving, then stops
+//	accepting connections and waits for in-flight requests, queued jobs and the
+//	callbacks they send, the storage pool is closed last. Callbacks still pending
+//	when the context is done are cancelled and logged as lost.
+func shutdown(ctx context.Context, drainDelay time.Duration, srv *http.Server, jq *JobQueue, ws *WebhookSender, pool *redis.Pool) error {
+	shuttingDown.Store(true)
+
+	select {
+	case <-time.After(drainDelay):
+	case <-ctx.Done():
+	}
+
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("draining requests failed", "component", "server", "error", err)
+		errs = append(errs, err)
+	}
+	if jq != nil {
+		if err := jq.Close(ctx); err != nil {
+			slog.Error("draining jobs failed", "component", "server", "queued", jq.Len(), "error", err)
+			errs = append(errs, err)
+		}
+	}
+	if err := ws.Wait(ctx); err != nil {
+		slog.Error("draining callbacks failed", "component", "server", "error", err)
+		errs = append(errs, err)
+	}
+	if pool != nil {
+		if err := pool.Close(); err != nil {
+			slog.Error("closing storage failed", "component", "server", "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestShutdownDrainsRequestsAndJobs(t *testing.T) {
+	defer shuttingDown.Store(false)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	}))
+	ts.Start()
+
+	jq := newJobQueue(newMemoryJobStore(), 1, 1, time.Minute)
+	jobFinished := false
+	if _, err := jq.Submit(context.Background(), "ab7300", func(ctx context.Context, jobId string) (string, Diagnostics, error) {
+		<-release
+		jobFinished = true
+		return "abc", nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	response := make(chan string)
+	go func() {
+		res, err := http.Get(ts.URL)
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		response <- string(body)
+	}()
+	<-started
+
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- shutdown(context.Background(), 0, ts.Config, jq, newWebhookSender(), &redis.Pool{})
+	}()
+
+	redisPool = &redis.Pool{Dial: func() (redis.Conn, error) { return nil, errors.New("connection refused") }}
+	defer func() { redisPool = nil }()
+
+	w := httptest.NewRecorder()
+	for !shuttingDown.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	readyHandler(w, httptest.NewRequest("GET", "/v1/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "shutting_down") {
+		t.Errorf("Readiness while shutting down should be 503, got %d %s!", w.Code, w.Body.String())
+	}
+
+	close(release)
+	if body := <-response; body != "done" {
+		t.Errorf("In-flight request should be finished, got '%s'", body)
+	}
+	if err := <-shutdownDone; err != nil {
+		t.Errorf("Shutdown should succeed, got %v", err)
+	}
+	if !jobFinished {
+		t.Error("Queued job should be finished before shutdown returns")
+	}
+	if _, err := jq.Submit(context.Background(), "ab7300", nil); err != ErrJobQueueClosed {
+		t.Errorf("Job queue should be closed after shutdown, got %v", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	defer shuttingDown.Store(false)
+
+	jq := newJobQueue(newMemoryJobStore(), 1, 1, time.Minute)
+	release := make(chan struct{})
+	defer close(release)
+	jq.Submit(context.Background(), "ab7300", func(ctx context.Context, jobId string) (string, Diagnostics, error) {
+		<-release
+		return "abc", nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := shutdown(ctx, 0, &http.Server{}, jq, newWebhookSender(), nil); err == nil {
+		t.Error("Shutdown with a running job should time out")
+	}
+}
+
+func TestShutdownDrainDelay(t *testing.T) {
+	defer shuttingDown.Store(false)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	}))
+	defer ts.Close()
+
+	timeStart := time.Now()
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- shutdown(context.Background(), 100*time.Millisecond, ts.Config, nil, newWebhookSender(), nil)
+	}()
+	for !shuttingDown.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Requests during the drain delay should be served, got %s", err)
+	}
+	res.Body.Close()
+
+	if err = <-shutdownDone; err != nil {
+		t.Errorf("Shutdown should succeed, got %v", err)
+	}
+	if elapsed := time.Since(timeStart); elapsed < 100*time.Millisecond {
+		t.Errorf("Shutdown should wait for the drain delay, took %s", elapsed)
+	}
+}
+
+func TestServerConfigValidate(t *testing.T) {
+	if err := (ServerConfig{TLSCertFile: "cert.pem"}).validate(); err == nil {
+		t.Error("TLS certificate without key should not be valid")
+	}
+	if err := (ServerConfig{ReadTimeout: -time.Second}).validate(); err == nil {
+		t.Error("Negative timeout should not be valid")
+	}
+	if err := (ServerConfig{ShutdownDrainDelay: -time.Second}).validate(); err == nil {
+		t.Error("Negative drain delay should not be valid")
+	}
+	if err := (ServerConfig{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", ShutdownTimeout: time.Second}).validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//	ConsumerToken describes an issued consumer token, the token itself is never
+//	stored, only its SHA-256 hash
+type ConsumerToken struct {
+	TokenId, Owner       string
+	CreatedAt, ExpiresAt time.Time
+	//	Limits override the token tier limits, zero values use the tier defaults and
+	//	unlimitedLimit lifts a limit
+	Limits TokenLimits
+	//	CallbackUrl receives results of all uploads of the token, CallbackSecret signs them
+	CallbackUrl, CallbackSecret string
+}
+
+//	IssuedConsumerToken is returned once when a token is issued or rotated
+type IssuedConsumerToken struct {
+	ConsumerToken
+	Token string
+}
+
+//	Expired reports whether the token has an expiration which already passed
+func (ct *ConsumerToken) Expired(timeNow time.Time) bool {
+	return !ct.ExpiresAt.IsZero() && !timeNow.Before(ct.ExpiresAt)
+}
+
+//	IssueConsumerToken creates a new token for the owner, expiresIn of 0 issues a
+//	token which never expires
+func IssueConsumerToken(owner string, expiresIn time.Duration, limits TokenLimits, callbackUrl string) (IssuedConsumerToken, error) {
+	tokenId, err := randomHex(8)
+	if err != nil {
+		return IssuedConsumerToken{}, err
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return IssuedConsumerToken{}, err
+	}
+
+	callbackSecret, err := randomHex(32)
+	if err != nil {
+		return IssuedConsumerToken{}, err
+	}
+
+	ct := ConsumerToken{TokenId: tokenId, Owner: owner, CreatedAt: time.Now().UTC(), Limits: limits, CallbackUrl: callbackUrl, CallbackSecret: callbackSecret}
+	if expiresIn > 0 {
+		ct.ExpiresAt = ct.CreatedAt.Add(expiresIn)
+	}
+
+	if err = SaveConsumerToken(&ct, hashConsumerToken(token), ""); err != nil {
+		return IssuedConsumerToken{}, err
+	}
+
+	return IssuedConsumerToken{ConsumerToken: ct, Token: token}, nil
+}
+
+//	RotateConsumerToken replaces the token while keeping its id, owner, expiration,
+//	limits and callback, the previous token stops working immediately. Tokens issued
+//	without a callback secret get one.
+func RotateConsumerToken(tokenId string) (IssuedConsumerToken, error) {
+	ct, oldHash, err := GetConsumerTokenById(tokenId)
+	if err != nil {
+		return IssuedConsumerToken{}, err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return IssuedConsumerToken{}, err
+	}
+	if len(ct.CallbackSecret) == 0 {
+		if ct.CallbackSecret, err = randomHex(32); err != nil {
+			return IssuedConsumerToken{}, err
+		}
+	}
+
+	if err = SaveConsumerToken(&ct, hashConsumerToken(token), oldHash); err != nil {
+		return IssuedConsumerToken{}, err
+	}
+
+	return IssuedConsumerToken{ConsumerToken: ct, Token: token}, nil
+}
+
+//	RevokeConsumerToken returns false when there is no such token
+func RevokeConsumerToken(tokenId string) (bool, error) {
+	_, hash, err := GetConsumerTokenById(tokenId)
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, DeleteConsumerToken(tokenId, hash)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
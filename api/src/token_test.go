@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestConsumerTokenExpired(t *testing.T) {
+	timeNow := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		expiresAt time.Time
+		expired   bool
+	}{
+		{time.Time{}, false},
+		{timeNow.Add(time.Second), false},
+		{timeNow, true},
+		{timeNow.Add(-time.Hour), true},
+	} {
+		ct := ConsumerToken{ExpiresAt: tc.expiresAt}
+		if ct.Expired(timeNow) != tc.expired {
+			t.Errorf("Token expiring at %s should be expired %v", tc.expiresAt, tc.expired)
+		}
+	}
+}
+
+func TestHashConsumerToken(t *testing.T) {
+	hash := hashConsumerToken("secret")
+	if hash != "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b" {
+		t.Errorf("Token hash should be hex SHA-256, got '%s'", hash)
+	}
+	if hashConsumerToken("secret2") == hash {
+		t.Error("Different tokens should have different hashes")
+	}
+}
+
+func TestConsumerTokenLifecycle(t *testing.T) {
+	storage, restore := useFakeRedis()
+	defer restore()
+
+	limits := TokenLimits{RequestsPerHour: 10}
+	issued, err := IssueConsumerToken("lab", time.Hour, limits, "https://203.0.113.10/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issued.Token) != 64 || len(issued.TokenId) != 16 || len(issued.CallbackSecret) != 64 {
+		t.Errorf("Issued token should have random token, id and secret, got %+v", issued)
+	}
+	if !issued.ExpiresAt.Equal(issued.CreatedAt.Add(time.Hour)) {
+		t.Errorf("Token should expire an hour after it was created, got %s", issued.ExpiresAt)
+	}
+	for key, value := range storage.values {
+		if strings.Contains(key, issued.Token) || strings.Contains(string(value), issued.Token) {
+			t.Errorf("Token should be stored only as its hash, found it in %s", key)
+		}
+	}
+
+	ct, err := GetConsumerToken(issued.Token)
+	if err != nil || ct.TokenId != issued.TokenId || ct.Owner != "lab" || ct.Limits != limits {
+		t.Fatalf("Issued token should be found, got %+v %v", ct, err)
+	}
+
+	rotated, err := RotateConsumerToken(issued.TokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.TokenId != issued.TokenId || rotated.Token == issued.Token || rotated.CallbackSecret != issued.CallbackSecret || !rotated.ExpiresAt.Equal(issued.ExpiresAt) {
+		t.Errorf("Rotation should replace only the token, got %+v", rotated)
+	}
+	if _, err = GetConsumerToken(issued.Token); err != redis.ErrNil {
+		t.Errorf("Rotated token should stop working, got %v", err)
+	}
+	if ct, err = GetConsumerToken(rotated.Token); err != nil || ct.TokenId != issued.TokenId {
+		t.Errorf("New token should work, got %+v %v", ct, err)
+	}
+
+	revoked, err := RevokeConsumerToken(issued.TokenId)
+	if err != nil || !revoked {
+		t.Fatalf("Token should be revoked, got %v %v", revoked, err)
+	}
+	if _, err = GetConsumerToken(rotated.Token); err != redis.ErrNil {
+		t.Errorf("Revoked token should stop working, got %v", err)
+	}
+	if tokenIds, _ := GetConsumerTokenIds(); len(tokenIds) != 0 {
+		t.Errorf("Revoked token should not be listed, got %v", tokenIds)
+	}
+	if revoked, err = RevokeConsumerToken(issued.TokenId); err != nil || revoked {
+		t.Errorf("Revoking twice should report a missing token, got %v %v", revoked, err)
+	}
+	if _, err = RotateConsumerToken(issued.TokenId); err != redis.ErrNil {
+		t.Errorf("Rotating a revoked token should fail, got %v", err)
+	}
+}
+
+func TestExpiredConsumerToken(t *testing.T) {
+	_, restore := useFakeRedis()
+	defer restore()
+
+	issued, err := IssueConsumerToken("lab", time.Hour, TokenLimits{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued.ExpiresAt = time.Now().Add(-time.Second)
+	if err = SaveConsumerToken(&issued.ConsumerToken, hashConsumerToken(issued.Token), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = GetConsumerToken(issued.Token); err != redis.ErrNil {
+		t.Errorf("Expired token should not be found, got %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	//	multipartFieldsSize limits the form fields sent with a multipart upload
+	multipartFieldsSize = 64 << 10
+	//	unlimitedUploadSize applies to tokens without upload size limit when the server
+	//	max upload size is not set either
+	unlimitedUploadSize = 1 << 30
+)
+
+var (
+	//	serverMaxUploadSize caps the upload size of every tier, 0 leaves the tier limits
+	serverMaxUploadSize int64
+
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+
+	errUploadTooLarge = errors.New("upload is too large")
+)
+
+//	readUpload reads the run file of the request. The body may be compressed with
+//	gzip or zstd Content-Encoding, a gzip file or a zip archive with a single run
+//	file. maxSize limits the body and the decompressed content, binary content is
+//	rejected. The filename of the run file in the archive is returned, if any.
+func readUpload(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, string, bool) {
+	body, err := decodeContentEncoding(http.MaxBytesReader(w, r.Body, maxSize), r.Header.Get("Content-Encoding"), maxSize)
+	if err != nil {
+		slog.WarnContext(r.Context(), "content encoding is not supported", "component", "upload", "error", err)
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "unsupported_encoding", err.Error())
+		return nil, "", false
+	}
+	defer body.Close()
+
+	return readRunFile(w, r, body, maxSize)
+}
+
+//	readMultipartUpload reads a multipart/form-data upload, the run file is the part
+//	named file and the other parts are returned as form fields
+func readMultipartUpload(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, string, url.Values, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartFieldsSize)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		slog.WarnContext(r.Context(), "body is not multipart", "component", "upload", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+		return nil, "", nil, false
+	}
+
+	var content []byte
+	var filename string
+	fields := url.Values{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeUploadError(w, r, err, maxSize)
+			return nil, "", nil, false
+		}
+
+		if part.FormName() != "file" {
+			value, err := readLimited(part, multipartFieldsSize)
+			if err != nil {
+				writeUploadError(w, r, err, maxSize)
+				return nil, "", nil, false
+			}
+			fields.Add(part.FormName(), string(value))
+			continue
+		}
+
+		if content != nil {
+			slog.WarnContext(r.Context(), "multipart body has more than one file", "component", "upload")
+			writeProblem(w, r, http.StatusBadRequest, "invalid_body", "multipart body must have exactly one file part")
+			return nil, "", nil, false
+		}
+
+		var ok bool
+		if content, filename, ok = readRunFile(w, r, part, maxSize); !ok {
+			return nil, "", nil, false
+		}
+		if len(filename) == 0 {
+			filename = part.FileName()
+		}
+	}
+
+	if content == nil {
+		slog.WarnContext(r.Context(), "multipart body without file", "component", "upload")
+		writeProblem(w, r, http.StatusBadRequest, "missing_file", "multipart body must have a part named file")
+		return nil, "", nil, false
+	}
+
+	return content, filename, fields, true
+}
+
+//	readRunFile reads the run file from body, unpacks gzip files and zip archives and
+//	rejects binary content
+func readRunFile(w http.ResponseWriter, r *http.Request, body io.Reader, maxSize int64) ([]byte, string, bool) {
+	content, err := readLimited(body, maxSize)
+	if err == nil && bytes.HasPrefix(content, gzipMagic) {
+		content, err = gunzip(content, maxSize)
+	}
+
+	var filename string
+	if err == nil && bytes.HasPrefix(content, zipMagic) {
+		content, filename, err = unzipRunFile(content, maxSize)
+	}
+
+	if err != nil {
+		writeUploadError(w, r, err, maxSize)
+		return nil, "", false
+	}
+
+	if diagnostic, binary := sniffBinary(content); binary {
+		slog.WarnContext(r.Context(), "upload is binary", "component", "upload", "offset", diagnostic.Column)
+		writeProblem(w, r, http.StatusUnsupportedMediaType, "binary_content", "upload is not a text run file export", diagnostic)
+		return nil, "", false
+	}
+
+	return content, filename, true
+}
+
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error, maxSize int64) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) || err == errUploadTooLarge {
+		slog.WarnContext(r.Context(), "upload exceeds max upload size", "component", "upload", "max_upload_size", maxSize)
+		writeProblem(w, r, http.StatusRequestEntityTooLarge, "upload_too_large", fmt.Sprintf("uploads are limited to %d bytes, also after decompression", maxSize))
+		return
+	}
+
+	slog.WarnContext(r.Context(), "reading upload failed", "component", "upload", "error", err)
+	writeProblem(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+}
+
+func decodeContentEncoding(body io.ReadCloser, contentEncoding string, maxSize int64) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return zr, nil
+	case "zstd":
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("content encoding '%s' is not gzip or zstd", contentEncoding)
+}
+
+//	readLimited reads up to maxSize bytes, errUploadTooLarge is returned for more
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, errUploadTooLarge
+	}
+
+	return content, nil
+}
+
+func gunzip(content []byte, maxSize int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return readLimited(zr, maxSize)
+}
+
+//	unzipRunFile extracts the only run file of the archive, directories and files
+//	added by archivers like __MACOSX/ and .DS_Store are skipped
+func unzipRunFile(content []byte, maxSize int64) ([]byte, string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	files := []*zip.File{}
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) != 1 {
+		return nil, "", fmt.Errorf("zip archive has %d run files, it must have exactly one", len(files))
+	}
+
+	if files[0].UncompressedSize64 > uint64(maxSize) {
+		return nil, "", errUploadTooLarge
+	}
+
+	fr, err := files[0].Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer fr.Close()
+
+	runFile, err := readLimited(fr, maxSize)
+
+	return runFile, path.Base(files[0].Name), err
+}
+
+//	sniffBinary reports content with NUL bytes or invalid UTF-8, the diagnostic points
+//	at the first offending byte. UTF-16 with a byte order mark is sniffed after it is
+//	transcoded like parsers do.
+func sniffBinary(content []byte) (Diagnostic, bool) {
+	if hasUTF16BOM(content) {
+		return sniffBinaryUTF16(content)
+	}
+
+	offset := bytes.IndexByte(content, 0)
+	if offset < 0 && !utf8.Valid(content) {
+		for offset = 0; offset < len(content); {
+			r, size := utf8.DecodeRune(content[offset:])
+			if r == utf8.RuneError && size <= 1 {
+				break
+			}
+			offset += size
+		}
+	}
+	if offset < 0 {
+		return Diagnostic{}, false
+	}
+
+	return binaryDiagnostic(content, offset, "byte is not valid UTF-8 text", fmt.Sprintf("0x%02x", content[offset])), true
+}
+
+//	sniffBinaryUTF16 reports NUL characters and invalid UTF-16 which the transcoding
+//	replaced with U+FFFD, a truncated last code unit included. The diagnostic points
+//	at the transcoded text.
+func sniffBinaryUTF16(content []byte) (Diagnostic, bool) {
+	text, err := io.ReadAll(decodeBOM(bytes.NewReader(content)))
+	if err != nil {
+		text = utf8.AppendRune(text, unicode.ReplacementChar)
+	}
+
+	offset := bytes.IndexByte(text, 0)
+	if replaced := bytes.IndexRune(text, unicode.ReplacementChar); replaced >= 0 && (offset < 0 || replaced < offset) {
+		return binaryDiagnostic(text, replaced, "character is not valid UTF-16 text", "U+FFFD"), true
+	}
+	if offset < 0 {
+		return Diagnostic{}, false
+	}
+
+	return binaryDiagnostic(text, offset, "character is not valid UTF-16 text", "0x00"), true
+}
+
+func binaryDiagnostic(text []byte, offset int, message, value string) Diagnostic {
+	line := bytes.Count(text[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(text[:offset], '\n')
+
+	return Diagnostic{Severity: severityError, Code: "binary_content", Message: message, Line: line, Column: column, Value: value}
+}
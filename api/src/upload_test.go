@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const uploadRunFile = "Applied Biosystems 7300 Real-Time PCR System\nSDS v1.4\n"
+
+func gzipBytes(content []byte) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write(content)
+	zw.Close()
+
+	return b.Bytes()
+}
+
+func zipBytes(files map[string]string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, content := range files {
+		f, _ := zw.Create(name)
+		f.Write([]byte(content))
+	}
+	zw.Close()
+
+	return b.Bytes()
+}
+
+func TestReadUpload(t *testing.T) {
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	zstdBody := zstdEncoder.EncodeAll([]byte(uploadRunFile), nil)
+
+	for name, tc := range map[string]struct {
+		body            []byte
+		contentEncoding string
+		filename        string
+		status          int
+	}{
+		"plain":          {[]byte(uploadRunFile), "", "", http.StatusOK},
+		"gzip encoding":  {gzipBytes([]byte(uploadRunFile)), "gzip", "", http.StatusOK},
+		"zstd encoding":  {zstdBody, "zstd", "", http.StatusOK},
+		"gzip file":      {gzipBytes([]byte(uploadRunFile)), "", "", http.StatusOK},
+		"zip archive":    {zipBytes(map[string]string{"runs/plate1.csv": uploadRunFile, "__MACOSX/._plate1.csv": "x", ".DS_Store": "x"}), "", "plate1.csv", http.StatusOK},
+		"zip two files":  {zipBytes(map[string]string{"plate1.csv": uploadRunFile, "plate2.csv": uploadRunFile}), "", "", http.StatusBadRequest},
+		"too large":      {[]byte(strings.Repeat("a", 2048)), "", "", http.StatusRequestEntityTooLarge},
+		"gzip bomb":      {gzipBytes([]byte(strings.Repeat("a", 1<<20))), "gzip", "", http.StatusRequestEntityTooLarge},
+		"unknown coding": {[]byte(uploadRunFile), "br", "", http.StatusUnsupportedMediaType},
+		"binary":         {[]byte("Applied\n\x00\x01\x02"), "", "", http.StatusUnsupportedMediaType},
+		"invalid utf8":   {[]byte("Applied\nab\xff"), "", "", http.StatusUnsupportedMediaType},
+	} {
+		r := httptest.NewRequest("POST", "/v1/qpcr/ab7300", bytes.NewReader(tc.body))
+		if len(tc.contentEncoding) > 0 {
+			r.Header.Set("Content-Encoding", tc.contentEncoding)
+		}
+		w := httptest.NewRecorder()
+
+		content, filename, ok := readUpload(w, r, 1024)
+		if tc.status != http.StatusOK {
+			if ok || w.Code != tc.status {
+				t.Errorf("%s: upload should fail with %d, got %d", name, tc.status, w.Code)
+			}
+			continue
+		}
+		if !ok || string(content) != uploadRunFile || filename != tc.filename {
+			t.Errorf("%s: upload should be read, got %d '%s' '%s'", name, w.Code, content, filename)
+		}
+	}
+}
+
+func TestSniffBinary(t *testing.T) {
+	diagnostic, binary := sniffBinary([]byte("line 1\nab\xffc"))
+	if !binary || diagnostic.Line != 2 || diagnostic.Column != 3 || diagnostic.Value != "0xff" {
+		t.Errorf("Invalid UTF-8 should be reported at line 2 column 3, got %#v", diagnostic)
+	}
+
+	if _, binary = sniffBinary([]byte("Well,Sample,Détecteur\n")); binary {
+		t.Error("UTF-8 text should not be binary!")
+	}
+
+	utf16le := func(content []byte) []byte { return append([]byte{0xff, 0xfe}, content...) }
+	if _, binary = sniffBinary(utf16le([]byte("W\x00e\x00l\x00l\x00\n\x00A\x001\x00"))); binary {
+		t.Error("UTF-16 text should not be binary!")
+	}
+	for name, tc := range map[string]struct {
+		content []byte
+		column  int
+		value   string
+	}{
+		"NUL":            {[]byte("W\x00e\x00l\x00l\x00\n\x00A\x00\x00\x00"), 2, "0x00"},
+		"lone surrogate": {[]byte("W\x00e\x00l\x00l\x00\n\x00A\x00\x00\xdcB\x00"), 2, "U+FFFD"},
+		"truncated unit": {[]byte("W\x00e\x00l\x00l\x00\n\x00A\x00B"), 2, "U+FFFD"},
+	} {
+		diagnostic, binary := sniffBinary(utf16le(tc.content))
+		if !binary || diagnostic.Line != 2 || diagnostic.Column != tc.column || diagnostic.Value != tc.value {
+			t.Errorf("UTF-16 %s should be reported at line 2 column %d, got %#v", name, tc.column, diagnostic)
+		}
+	}
+}
+
+func TestReadMultipartUpload(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("calibrator", "mock")
+	fw, _ := mw.CreateFormFile("file", "plate1.csv")
+	fw.Write(gzipBytes([]byte(uploadRunFile)))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/v2/experiments", bytes.NewReader(body.Bytes()))
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	content, filename, fields, ok := readMultipartUpload(w, r, 1024)
+	if !ok || string(content) != uploadRunFile || filename != "plate1.csv" || fields.Get("calibrator") != "mock" {
+		t.Errorf("Multipart upload should be read, got %d '%s' '%s' %v", w.Code, content, filename, fields)
+	}
+
+	body.Reset()
+	mw = multipart.NewWriter(&body)
+	mw.WriteField("calibrator", "mock")
+	mw.Close()
+
+	r = httptest.NewRequest("POST", "/v2/experiments", bytes.NewReader(body.Bytes()))
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	if _, _, _, ok = readMultipartUpload(w, r, 1024); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("Multipart upload without file should fail with 400, got %d", w.Code)
+	}
+}
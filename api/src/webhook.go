@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	callbackSignatureHeader = "X-Qpcrbox-Signature"
+	callbackTimestampHeader = "X-Qpcrbox-Timestamp"
+	callbackDeliveryHeader  = "X-Qpcrbox-Delivery"
+
+	callbackEventComputed = "experiment.computed"
+	callbackEventFailed   = "experiment.failed"
+
+	callbackLookupTimeout = 5 * time.Second
+)
+
+var (
+	ErrCallbackAddress = errors.New("callback address is not public")
+
+	webhookSender = newWebhookSender()
+
+	//	callbackAddressAllowed guards every callback connection, callbacks must not
+	//	reach the api infrastructure
+	callbackAddressAllowed = isPublicAddress
+
+	//	nonPublicNetworks are globally routable looking networks which are not public,
+	//	this network and the carrier-grade NAT shared address space
+	nonPublicNetworks = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10")
+)
+
+//	Callback is where computation results are posted, Secret signs the requests
+type Callback struct {
+	Url, Secret string
+}
+
+//	CallbackEvent is the body of callback requests, receivers verify it with the
+//	X-Qpcrbox-Signature header, hex HMAC-SHA256 of "<X-Qpcrbox-Timestamp>.<body>"
+//	keyed with the callback secret of the consumer token
+type CallbackEvent struct {
+	Event, DeliveryId, Status, ExperimentId, JobId string
+	Warnings                                       Diagnostics
+	Problem                                        *Problem
+	CreatedAt                                      time.Time
+}
+
+//	WebhookSender delivers callbacks in the background, failed deliveries are retried
+//	with exponential backoff until MaxAttempts
+type WebhookSender struct {
+	sync.Mutex
+	Client              *http.Client
+	MaxAttempts         int
+	Backoff, MaxBackoff time.Duration
+
+	deliveries sync.WaitGroup
+	//	pending cancels the deliveries in progress by delivery id
+	pending map[string]context.CancelFunc
+}
+
+//	newWebhookSender connects only to public addresses checked when dialing, so hosts
+//	resolving to internal addresses after the upload are refused too. Proxies are not
+//	used and redirects are not followed, the redirect response fails the delivery.
+func newWebhookSender() *WebhookSender {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: callbackDialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &WebhookSender{
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxAttempts: 6,
+		Backoff:     2 * time.Second,
+		MaxBackoff:  5 * time.Minute,
+	}
+}
+
+//	Send delivers the event in a new goroutine, the context only carries values like
+//	the request id
+func (ws *WebhookSender) Send(ctx context.Context, cb Callback, event CallbackEvent) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	ws.Lock()
+	if ws.pending == nil {
+		ws.pending = make(map[string]context.CancelFunc)
+	}
+	ws.pending[event.DeliveryId] = cancel
+	ws.Unlock()
+
+	ws.deliveries.Add(1)
+	go func() {
+		defer ws.deliveries.Done()
+		defer ws.finish(event.DeliveryId)
+
+		err := ws.deliver(ctx, cb, event)
+		switch {
+		case err == nil:
+			webhookDeliveriesTotal.Inc("delivered")
+			slog.InfoContext(ctx, "callback delivered", "component", "webhook", "delivery_id", event.DeliveryId, "url", cb.Url)
+		case ctx.Err() != nil:
+			webhookDeliveriesTotal.Inc("lost")
+			slog.ErrorContext(ctx, "callback delivery lost on shutdown", "component", "webhook", "delivery_id", event.DeliveryId, "url", cb.Url, "error", err)
+		default:
+			webhookDeliveriesTotal.Inc("failed")
+			slog.WarnContext(ctx, "callback delivery failed", "component", "webhook", "delivery_id", event.DeliveryId, "url", cb.Url, "error", err)
+		}
+	}()
+}
+
+func (ws *WebhookSender) finish(deliveryId string) {
+	ws.Lock()
+	defer ws.Unlock()
+
+	if cancel, found := ws.pending[deliveryId]; found {
+		cancel()
+		delete(ws.pending, deliveryId)
+	}
+}
+
+//	Wait blocks until pending deliveries are finished, when the context is done first
+//	they are cancelled, which logs them as lost, and the context error is returned
+func (ws *WebhookSender) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ws.deliveries.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	ws.Lock()
+	for _, cancel := range ws.pending {
+		cancel()
+	}
+	ws.Unlock()
+	<-done
+
+	return ctx.Err()
+}
+
+//	deliver posts the event until it is accepted, responses other than 5xx and 429
+//	are not retried
+func (ws *WebhookSender) deliver(ctx context.Context, cb Callback, event CallbackEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := ws.post(ctx, cb, event.DeliveryId, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= ws.MaxAttempts {
+			return fmt.Errorf("attempt %d: %s", attempt, err)
+		}
+
+		backoff := ws.backoff(attempt)
+		webhookDeliveriesTotal.Inc("retried")
+		slog.DebugContext(ctx, "callback delivery will be retried", "component", "webhook", "delivery_id", event.DeliveryId, "attempt", attempt, "backoff", backoff, "error", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (ws *WebhookSender) post(ctx context.Context, cb Callback, deliveryId string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", cb.Url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "qpcrbox/"+version)
+	req.Header.Set(callbackDeliveryHeader, deliveryId)
+	req.Header.Set(callbackTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(callbackSignatureHeader, "sha256="+signCallback(cb.Secret, timestamp, body))
+
+	res, err := ws.Client.Do(req)
+	if err != nil {
+		return !errors.Is(err, ErrCallbackAddress), err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, fmt.Errorf("callback responded with %d", res.StatusCode)
+}
+
+//	backoff doubles the delay after every failed attempt
+func (ws *WebhookSender) backoff(attempt int) time.Duration {
+	backoff := ws.Backoff
+	for i := 1; i < attempt && backoff < ws.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > ws.MaxBackoff {
+		backoff = ws.MaxBackoff
+	}
+
+	return backoff
+}
+
+func signCallback(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//	parseCallbackUrl accepts absolute http and https urls of hosts resolving only to
+//	public addresses
+func parseCallbackUrl(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Hostname()) == 0 {
+		return "", errors.New("callback url '" + value + "' is not an absolute http or https url")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callbackLookupTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("callback host '%s' can not be resolved", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !callbackAddressAllowed(addr.IP) {
+			return "", fmt.Errorf("callback host '%s' resolves to %s which is not a public address", u.Hostname(), addr.IP)
+		}
+	}
+
+	return u.String(), nil
+}
+
+//	isPublicAddress rejects loopback, private, link-local, multicast and unspecified
+//	addresses, also when mapped to IPv6
+func isPublicAddress(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+//	callbackDialControl checks the resolved address right before connecting
+func callbackDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !callbackAddressAllowed(ip) {
+		return fmt.Errorf("%w: %s", ErrCallbackAddress, host)
+	}
+
+	return nil
+}
+
+func mustParseCIDRs(values ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, value := range values {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+//	requestCallback returns the callback of the upload, the Callback-Url header or
+//	callback-url query parameter override the callback url of the consumer token.
+//	Callbacks are signed with the token secret, so they require a consumer token.
+func requestCallback(w http.ResponseWriter, r *http.Request, ct *ConsumerToken) (Callback, bool) {
+	callbackUrl := r.URL.Query().Get("callback-url")
+	if len(callbackUrl) == 0 {
+		callbackUrl = r.Header.Get("Callback-Url")
+	}
+	if len(callbackUrl) == 0 && ct != nil {
+		callbackUrl = ct.CallbackUrl
+	}
+	if len(callbackUrl) == 0 {
+		return Callback{}, true
+	}
+
+	if ct == nil {
+		slog.InfoContext(r.Context(), "callback without consumer token", "component", "webhook")
+		writeProblem(w, r, http.StatusUnauthorized, "missing_consumer_token", "callbacks require a consumer token")
+		return Callback{}, false
+	}
+	if len(ct.CallbackSecret) == 0 {
+		slog.InfoContext(r.Context(), "consumer token has no callback secret", "component", "webhook", "token_id", ct.TokenId)
+		writeProblem(w, r, http.StatusBadRequest, "missing_callback_secret", "consumer token has no callback secret, rotate it to get one")
+		return Callback{}, false
+	}
+
+	callbackUrl, err := parseCallbackUrl(callbackUrl)
+	if err != nil {
+		slog.InfoContext(r.Context(), "callback url is not valid", "component", "webhook", "error", err)
+		writeProblem(w, r, http.StatusBadRequest, "invalid_callback_url", err.Error())
+		return Callback{}, false
+	}
+
+	return Callback{Url: callbackUrl, Secret: ct.CallbackSecret}, true
+}
+
+//	notifyCallback sends the outcome of the computation to the callback, if any
+func notifyCallback(ctx context.Context, cb Callback, jobId, expId string, warnings Diagnostics, err error) {
+	if len(cb.Url) == 0 {
+		return
+	}
+
+	deliveryId, randErr := randomHex(16)
+	if randErr != nil {
+		slog.ErrorContext(ctx, "generating delivery id failed", "component", "webhook", "error", randErr)
+		return
+	}
+
+	event := CallbackEvent{Event: callbackEventComputed, DeliveryId: deliveryId, Status: jobDone, ExperimentId: expId, JobId: jobId, Warnings: warnings, CreatedAt: time.Now().UTC()}
+	if err != nil {
+		problem := computationProblem(err)
+		event.Event, event.Status, event.Problem = callbackEventFailed, jobFailed, &problem
+	}
+
+	webhookSender.Send(ctx, cb, event)
+}
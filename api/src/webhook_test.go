@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(callbackTimestampHeader), 10, 64)
+		if r.Header.Get(callbackSignatureHeader) != "sha256="+signCallback("secret", timestamp, body) {
+			t.Errorf("Callback signature is not valid!")
+		}
+
+		var event CallbackEvent
+		if err := json.Unmarshal(body, &event); err != nil || event.ExperimentId != "exp" || event.Status != jobDone || r.Header.Get(callbackDeliveryHeader) != event.DeliveryId {
+			t.Errorf("Callback event is not valid, got %s", body)
+		}
+
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ws := &WebhookSender{Client: server.Client(), MaxAttempts: 5, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	event := CallbackEvent{Event: callbackEventComputed, DeliveryId: "d1", Status: jobDone, ExperimentId: "exp"}
+	if err := ws.deliver(context.Background(), Callback{Url: server.URL, Secret: "secret"}, event); err != nil {
+		t.Fatalf("Delivery failed with error: %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Delivery should succeed on the 3rd attempt, got %d attempts", attempts)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	for status, expectedAttempts := range map[int]int32{http.StatusBadRequest: 1, http.StatusInternalServerError: 3} {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			w.WriteHeader(status)
+		}))
+
+		ws := &WebhookSender{Client: server.Client(), MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+		if err := ws.deliver(context.Background(), Callback{Url: server.URL, Secret: "secret"}, CallbackEvent{}); err == nil {
+			t.Errorf("Delivery answered with %d should fail!", status)
+		}
+		if attempts != expectedAttempts {
+			t.Errorf("Delivery answered with %d should be attempted %d times, got %d", status, expectedAttempts, attempts)
+		}
+		server.Close()
+	}
+}
+
+func TestWebhookSenderWaitCancelsPendingDeliveries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	lost, _ := seriesValue(webhookDeliveriesTotal, "lost")
+
+	ws := &WebhookSender{Client: server.Client(), MaxAttempts: 5, Backoff: time.Hour, MaxBackoff: time.Hour}
+	ws.Send(context.Background(), Callback{Url: server.URL, Secret: "secret"}, CallbackEvent{DeliveryId: "d1"})
+	for atomic.LoadInt32(&attempts) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ws.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Waiting for a delivery in backoff should time out, got %v", err)
+	}
+	if value, _ := seriesValue(webhookDeliveriesTotal, "lost"); value != lost+1 {
+		t.Errorf("Cancelled delivery should be counted as lost, got %v lost before %v", value, lost)
+	}
+	if len(ws.pending) != 0 {
+		t.Errorf("Cancelled delivery should not be pending, got %d", len(ws.pending))
+	}
+}
+
+func TestWebhookSenderRefusesInternalAddresses(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer server.Close()
+
+	ws := newWebhookSender()
+	ws.MaxAttempts, ws.Backoff = 3, time.Millisecond
+	err := ws.deliver(context.Background(), Callback{Url: server.URL, Secret: "secret"}, CallbackEvent{})
+	if err == nil || !strings.HasPrefix(err.Error(), "attempt 1:") || !strings.Contains(err.Error(), ErrCallbackAddress.Error()) {
+		t.Errorf("Delivery to loopback should be refused without retries, got %v", err)
+	}
+	if attempts != 0 {
+		t.Errorf("Loopback callback should not be reached, got %d attempts", attempts)
+	}
+}
+
+func TestWebhookSenderDoesNotFollowRedirects(t *testing.T) {
+	callbackAddressAllowed = func(ip net.IP) bool { return true }
+	defer func() { callbackAddressAllowed = isPublicAddress }()
+
+	var redirected int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			atomic.AddInt32(&redirected, 1)
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	ws := newWebhookSender()
+	ws.MaxAttempts, ws.Backoff = 3, time.Millisecond
+	if err := ws.deliver(context.Background(), Callback{Url: server.URL + "/hook", Secret: "secret"}, CallbackEvent{}); err == nil || !strings.Contains(err.Error(), "responded with 307") {
+		t.Errorf("Redirected delivery should fail with the redirect status, got %v", err)
+	}
+	if redirected != 0 {
+		t.Errorf("Redirect should not be followed, got %d requests", redirected)
+	}
+}
+
+func TestParseCallbackUrl(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"https://203.0.113.10/hook":       true,
+		"http://[2001:db8::10]:8080/hook": true,
+		"ftp://203.0.113.10/hook":         false,
+		"/hook":                           false,
+		"http://127.0.0.1:8080/hook":      false,
+		"http://localhost/hook":           false,
+		"http://10.1.2.3/hook":            false,
+		"http://192.168.1.10/hook":        false,
+		"http://169.254.169.254/latest":   false,
+		"http://0.0.0.0/hook":             false,
+		"http://100.64.0.1/hook":          false,
+		"http://224.0.0.1/hook":           false,
+		"http://[::1]/hook":               false,
+		"http://[::ffff:127.0.0.1]/hook":  false,
+		"http://[fe80::1]/hook":           false,
+		"http://[fd00::1]/hook":           false,
+	} {
+		if _, err := parseCallbackUrl(value); (err == nil) != valid {
+			t.Errorf("Callback url '%s' should be valid %v, got %v", value, valid, err)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	ws := &WebhookSender{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+	for attempt, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 30: 10 * time.Second} {
+		if backoff := ws.backoff(attempt); backoff != expected {
+			t.Errorf("Backoff of attempt %d should be %s, got %s", attempt, expected, backoff)
+		}
+	}
+}
+
+func TestRequestCallback(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/qpcr/ab7300?callback-url=http://203.0.113.10/hook", nil)
+	w := httptest.NewRecorder()
+	if _, ok := requestCallback(w, r, nil); ok || w.Code != http.StatusUnauthorized {
+		t.Errorf("Callback without consumer token should be 401, got %d", w.Code)
+	}
+
+	ct := &ConsumerToken{TokenId: "t1", CallbackUrl: "https://203.0.113.20/hook", CallbackSecret: "secret"}
+	w = httptest.NewRecorder()
+	if cb, ok := requestCallback(w, r, ct); !ok || cb.Url != "http://203.0.113.10/hook" || cb.Secret != "secret" {
+		t.Errorf("Callback url of the request should override the token, got %#v", cb)
+	}
+
+	w = httptest.NewRecorder()
+	if cb, ok := requestCallback(w, httptest.NewRequest("POST", "/v1/qpcr/ab7300", nil), ct); !ok || cb.Url != ct.CallbackUrl {
+		t.Errorf("Callback url of the token should be used, got %#v", cb)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/v1/qpcr/ab7300", nil)
+	r.Header.Set("Callback-Url", "ftp://203.0.113.10/hook")
+	if _, ok := requestCallback(w, r, ct); ok || w.Code != http.StatusBadRequest {
+		t.Errorf("Callback url with ftp scheme should be 400, got %d", w.Code)
+	}
+}
@@ -38,7 +38,7 @@ qpcrApp.controller('AB7300Ctrl', function($scope, $http, contentParser, $compile
             $http.post('http://api.qpcrbox.com/v1/qpcr/ab7300?mock=' + $scope.mock, $scope.qpcrData)
                 .success(function(data, status, headers, config) {
                     console.log("response code: " + status);
-                    if (status == 201) {
+                    if (status == 201 || status == 200) {
                         //  Get experiment result data
                         $http.get('http://api.qpcrbox.com/v1/experiment/' + data.ExperimentId, {headers: {'Accept': 'application/json'}})
                             .success(function(data, status, headers, config) {